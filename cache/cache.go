@@ -0,0 +1,200 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package cache
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Cache stores answers on disk, one file per key. It is safe for concurrent use.
+type Cache struct {
+	dir string
+}
+
+// Stats describes the content of the cache.
+type Stats struct {
+	Entries int
+	Bytes   int64
+	Oldest  time.Time
+	Newest  time.Time
+}
+
+// Key derives a cache key from the given parts.
+func Key(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// New creates a cache stored in dir. The directory is created on the first write.
+func New(dir string) *Cache {
+	return &Cache{
+		dir: dir,
+	}
+}
+
+// Dir returns the directory the cache is stored in.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+func (c *Cache) path(key string) string {
+	// Spread the entries over sub directories, the same way git stores loose objects.
+	return filepath.Join(c.dir, key[:2], key[2:])
+}
+
+// Get returns the value stored for key. A hit refreshes the modification time of the entry, which GC relies on.
+func (c *Cache) Get(key string) (string, bool) {
+	p := c.path(key)
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return "", false
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(p, now, now)
+
+	return string(data), true
+}
+
+// Put stores value for key. The entry is written to a temporary file first, so readers never see partial entries.
+func (c *Cache) Put(key, value string) error {
+	p := c.path(key)
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(value); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), p)
+}
+
+// walk calls fn for every entry of the cache, a missing cache directory is an empty cache.
+func (c *Cache) walk(fn func(path string, info fs.FileInfo) error) error {
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		return fn(path, info)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Stats counts the entries of the cache and their size.
+func (c *Cache) Stats() (Stats, error) {
+	var stats Stats
+
+	err := c.walk(func(path string, info fs.FileInfo) error {
+		stats.Entries += 1
+		stats.Bytes += info.Size()
+		if stats.Oldest.IsZero() || info.ModTime().Before(stats.Oldest) {
+			stats.Oldest = info.ModTime()
+		}
+		if info.ModTime().After(stats.Newest) {
+			stats.Newest = info.ModTime()
+		}
+		return nil
+	})
+
+	return stats, err
+}
+
+// Clear removes every entry and returns how many there were.
+func (c *Cache) Clear() (int, error) {
+	stats, err := c.Stats()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.RemoveAll(c.dir); err != nil {
+		return 0, err
+	}
+
+	return stats.Entries, nil
+}
+
+// GC removes the entries that were not used for longer than maxAge and returns how many were removed.
+func (c *Cache) GC(maxAge time.Duration) (int, error) {
+	removed := 0
+	cutoff := time.Now().Add(-maxAge)
+
+	err := c.walk(func(path string, info fs.FileInfo) error {
+		if info.ModTime().After(cutoff) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed += 1
+		return nil
+	})
+	if err != nil {
+		return removed, err
+	}
+
+	// Drop the sub directories that became empty, removing a non-empty one fails and is ignored.
+	entries, _ := os.ReadDir(c.dir)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			_ = os.Remove(filepath.Join(c.dir, entry.Name()))
+		}
+	}
+
+	return removed, nil
+}
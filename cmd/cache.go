@@ -0,0 +1,166 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/rammstein4o/git-gpt/cache"
+	"github.com/rammstein4o/git-gpt/git"
+	"github.com/rammstein4o/git-gpt/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// newSummaryCache opens the summary cache stored in $GIT_DIR/git-gpt/cache.
+func newSummaryCache(gitHelper git.Git) (*cache.Cache, error) {
+	gitDir, err := gitHelper.GitDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return cache.New(filepath.Join(strings.TrimSpace(gitDir), "git-gpt", "cache")), nil
+}
+
+// summaryCacheOrNil returns the summary cache, or nil when caching is disabled.
+func summaryCacheOrNil(gitHelper git.Git) (*cache.Cache, error) {
+	if viper.GetBool("cache.disabled") {
+		return nil, nil
+	}
+
+	return newSummaryCache(gitHelper)
+}
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the cache of per-file summaries",
+	Long: `Manage the cache of per-file summaries stored in $GIT_DIR/git-gpt/cache.
+
+Summaries are reused as long as the staged content, the prompt templates,
+the model, the chunk size, the diff context and the redaction settings
+stay the same.`,
+}
+
+// cacheStatsCmd represents the cache stats command
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show the number and size of cached summaries",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := utils.CwdToGitRoot(); err != nil {
+			return err
+		}
+
+		summaryCache, err := newSummaryCache(git.New())
+		if err != nil {
+			return err
+		}
+
+		stats, err := summaryCache.Stats()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Directory: %s\n", summaryCache.Dir())
+		fmt.Printf("Entries:   %d\n", stats.Entries)
+		fmt.Printf("Size:      %s\n", formatBytes(stats.Bytes))
+		if stats.Entries > 0 {
+			fmt.Printf("Oldest:    %s\n", stats.Oldest.Format(time.RFC3339))
+			fmt.Printf("Newest:    %s\n", stats.Newest.Format(time.RFC3339))
+		}
+
+		return nil
+	},
+}
+
+// cacheClearCmd represents the cache clear command
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all cached summaries",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := utils.CwdToGitRoot(); err != nil {
+			return err
+		}
+
+		summaryCache, err := newSummaryCache(git.New())
+		if err != nil {
+			return err
+		}
+
+		removed, err := summaryCache.Clear()
+		if err != nil {
+			return err
+		}
+
+		color.Green("Removed %d cached summaries", removed)
+		return nil
+	},
+}
+
+// cacheGcCmd represents the cache gc command
+var cacheGcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove cached summaries that were not used recently",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := utils.CwdToGitRoot(); err != nil {
+			return err
+		}
+
+		maxAge, _ := cmd.Flags().GetDuration("max-age")
+
+		summaryCache, err := newSummaryCache(git.New())
+		if err != nil {
+			return err
+		}
+
+		removed, err := summaryCache.GC(maxAge)
+		if err != nil {
+			return err
+		}
+
+		color.Green("Removed %d cached summaries not used within %s", removed, maxAge)
+		return nil
+	},
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
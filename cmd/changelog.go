@@ -0,0 +1,180 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/rammstein4o/git-gpt/git"
+	"github.com/rammstein4o/git-gpt/gpt"
+	"github.com/rammstein4o/git-gpt/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// changelogHeader starts a changelog file that does not exist yet.
+const changelogHeader = `# Changelog
+
+All notable changes to this project will be documented in this file.
+
+The format is based on [Keep a Changelog](https://keepachangelog.com/en/1.1.0/).
+`
+
+// changelogCmd represents the changelog command
+var changelogCmd = &cobra.Command{
+	Use:   "changelog <from>..<to>",
+	Short: "Write the release notes of a revision range",
+	Long: `Group the commits of the revision range into breaking changes, features,
+fixes and chores and write them as a Keep a Changelog section.
+
+Commits with a Conventional Commits header are sorted by their type, the
+others are classified by the model. Merge commits are left out. The section is
+printed to stdout, or prepended to --file under the --version heading.`,
+	Example: `  git gpt changelog v1.1.0..HEAD
+  git gpt changelog v1.1.0..v1.2.0 --version 1.2.0 --file CHANGELOG.md`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := utils.CwdToGitRoot(); err != nil {
+			return err
+		}
+
+		outputFile := viper.GetString("changelog.file")
+		// The section owns stdout unless it goes to a file, so progress goes to stderr.
+		if outputFile == "" {
+			color.Output = os.Stderr
+		}
+
+		version, err := cmd.Flags().GetString("version")
+		if err != nil {
+			return err
+		}
+		date, err := cmd.Flags().GetString("date")
+		if err != nil {
+			return err
+		}
+		if date == "" {
+			date = time.Now().Format(time.DateOnly)
+		}
+
+		language, err := outputLanguage(cmd)
+		if err != nil {
+			return err
+		}
+
+		gitHelper := newGitHelper()
+
+		commits, err := gitHelper.Log(args[0])
+		if err != nil {
+			return err
+		}
+
+		// The entries keep the order of the commits, whichever way they were classified.
+		entries := make([]gpt.ChangelogEntry, 0, len(commits))
+		unclassified := make([]git.CommitInfo, 0)
+		pending := make([]int, 0)
+		for _, commit := range commits {
+			if commit.IsMerge() {
+				continue
+			}
+			entry, ok := gpt.ClassifyConventionalCommit(commit)
+			if !ok {
+				unclassified = append(unclassified, commit)
+				pending = append(pending, len(entries))
+			}
+			entries = append(entries, entry)
+		}
+
+		if len(entries) == 0 {
+			return fmt.Errorf("there are no commits in %s", args[0])
+		}
+
+		if len(unclassified) > 0 {
+			gptHelper := newGptHelper(
+				gpt.WithLanguage(language),
+			)
+
+			color.Green("Classify %d commit(s) without a conventional header", len(unclassified))
+
+			classified, err := gptHelper.ClassifyCommits(cmd.Context(), unclassified)
+			if err != nil {
+				return err
+			}
+			for i, entry := range classified {
+				entries[pending[i]] = entry
+			}
+
+			printStats(gptHelper.GetStats(cmd.Context()))
+		}
+
+		section := gpt.RenderChangelog(version, date, entries)
+
+		if outputFile == "" {
+			fmt.Print(section)
+			return nil
+		}
+
+		color.Cyan("Prepend the changes to " + outputFile + " file")
+		return prependChangelog(outputFile, section)
+	},
+}
+
+// prependChangelog inserts the section above the newest release of the changelog, below its title, its introduction
+// and an [Unreleased] section. A missing file is created with the usual Keep a Changelog header.
+func prependChangelog(file, section string) error {
+	content, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(content) == 0 {
+		content = []byte(changelogHeader)
+	}
+
+	// The date does not matter, a version is only released once.
+	heading, _, _ := strings.Cut(section, "\n")
+	heading, _, _ = strings.Cut(heading, " - ")
+	lines := strings.SplitAfter(string(content), "\n")
+
+	insertAt := len(lines)
+	for i, line := range lines {
+		if line == heading+"\n" || strings.HasPrefix(line, heading+" ") {
+			return fmt.Errorf("%s already has a %q section", file, heading)
+		}
+		if insertAt == len(lines) && strings.HasPrefix(line, "## ") && !strings.HasPrefix(line, "## [Unreleased]") {
+			insertAt = i
+		}
+	}
+
+	head := strings.TrimRight(strings.Join(lines[:insertAt], ""), "\n")
+	tail := strings.Join(lines[insertAt:], "")
+
+	out := head + "\n\n" + section
+	if tail != "" {
+		out += "\n" + tail
+	}
+
+	return os.WriteFile(file, []byte(out), 0o644)
+}
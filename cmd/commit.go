@@ -23,8 +23,8 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"html"
 	"os"
 	"path"
 	"strings"
@@ -42,172 +42,202 @@ var commitCmd = &cobra.Command{
 	Use:   "commit",
 	Short: "Auto generate commit message",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		mode := viper.GetString("mode")
-
 		if err := utils.CwdToGitRoot(); err != nil {
 			return err
 		}
 
-		gitHelper := git.New(
-			git.WithExcludeList(viper.GetStringSlice("git.exclude_list")),
-		)
+		if err := setOutputFormat(viper.GetString("commit.output")); err != nil {
+			return err
+		}
+		jsonOutput := viper.GetString("commit.output") == OUTPUT_JSON
 
-		var topP float32
-		if err := viper.UnmarshalKey("completion.top_p", &topP); err != nil {
-			topP = 1.0
+		numCandidates := viper.GetInt("commit.candidates")
+		if numCandidates < 1 {
+			return fmt.Errorf("the number of candidates must be at least 1, got %d", numCandidates)
 		}
 
-		var temperature float32
-		if err := viper.UnmarshalKey("completion.temperature", &temperature); err != nil {
-			temperature = 0.4
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+
+		// Several candidates are shown side by side once all of them arrived.
+		stream := viper.GetBool("completion.stream") && numCandidates == 1 && !jsonOutput && !dryRun
+
+		switch style := viper.GetString("commit.style"); style {
+		case gpt.COMMIT_STYLE_DEFAULT, gpt.COMMIT_STYLE_CONVENTIONAL:
+		default:
+			return fmt.Errorf("unknown commit style %q", style)
+		}
+
+		language, err := outputLanguage(cmd)
+		if err != nil {
+			return err
+		}
+
+		amend, err := cmd.Flags().GetBool("amend")
+		if err != nil {
+			return err
+		}
+
+		gitHelper := newGitHelper()
+
+		// Amending describes the last commit together with the newly staged changes, i.e. its parent against the index.
+		previousMessage := ""
+		if amend {
+			base, err := gitHelper.AmendBase()
+			if err != nil {
+				return err
+			}
+
+			previousMessage, err = gitHelper.HeadMessage()
+			if err != nil {
+				return err
+			}
+
+			gitHelper = newGitHelper(git.WithDiffBase(base))
+		}
+
+		// A dry run shows every prompt, so nothing is taken from or written to the cache.
+		summaryCache, err := summaryCacheOrNil(gitHelper)
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			summaryCache = nil
 		}
 
 		gptOptions := []gpt.Option{
-			gpt.WithMaxTokens(viper.GetInt("completion.max_tokens")),
-			gpt.WithTopP(topP),
-			gpt.WithTemperature(temperature),
-			gpt.WithStream(viper.GetBool("completion.stream")),
-			gpt.WithMaxChunkSize(viper.GetInt("commit.maxChunkSize")),
-		}
-
-		if mode == "azure_open_ai" {
-			gptOptions = append(gptOptions, gpt.WithAzureOpenAI(
-				viper.GetString("azure_open_ai.api_key"),
-				viper.GetString("azure_open_ai.endpoint"),
-				viper.GetString("azure_open_ai.model"),
-				viper.GetString("azure_open_ai.alias"),
-			))
-		} else {
-			gptOptions = append(gptOptions, gpt.WithOpenAI(
-				viper.GetString("open_ai.api_key"),
-				viper.GetString("open_ai.model"),
-			))
+			gpt.WithStreamWriter(newColorWriter(color.FgYellow)),
+			gpt.WithCache(summaryCache),
+			gpt.WithContentFingerprint(gitHelper.ContentFingerprint()),
+			gpt.WithStream(stream),
+			gpt.WithLanguage(language),
+		}
+		if dryRun {
+			gptOptions = append(gptOptions, gpt.WithDryRun(color.Output))
 		}
 
-		gptHelper := gpt.New(
-			gptOptions...,
-		)
+		gptHelper := newGptHelper(gptOptions...)
 
 		names, err := gitHelper.DiffNames()
 		if err != nil {
 			return err
 		}
 		if names == "" {
+			if amend {
+				return fmt.Errorf("the last commit has no changes to describe")
+			}
 			return fmt.Errorf("please add your staged changes using git add <files...>")
 		}
 
 		color.Green("Summarize the stashed changes")
 
-		status, err := gitHelper.Status()
+		// The prompts of a dry run are printed in order.
+		concurrency := viper.GetInt("commit.concurrency")
+		if dryRun {
+			concurrency = 1
+		}
+
+		changes, changeSummaries, err := summarizeStagedChanges(
+			cmd.Context(),
+			gitHelper,
+			gptHelper,
+			concurrency,
+		)
 		if err != nil {
 			return err
 		}
 
-		addedFiles, removedFiles, modifiedFiles := git.ParseGitStatus(status)
-
-		changeSummaries := make([]string, 0)
+		summary, err := gptHelper.SummarizeChanges(cmd.Context(), changeSummaries)
+		if err != nil {
+			return err
+		}
 
-		for _, fileName := range addedFiles {
-			if utils.IsBinaryFile(fileName) {
-				changeSummaries = append(changeSummaries, fmt.Sprintf("Added binary file `%s`", fileName))
-				continue
-			}
+		hints, err := commitHints(gitHelper, changes)
+		if err != nil {
+			return err
+		}
+		hints.PreviousMessage = previousMessage
 
-			fileContent, err := utils.ReadFile(fileName)
-			if err != nil {
+		if dryRun {
+			if _, err := gptHelper.FinalizeCommitMsgCandidates(cmd.Context(), summary, hints, numCandidates); err != nil {
 				return err
 			}
 
-			summary, err := gptHelper.SummarizeFile(
-				cmd.Context(),
-				git.OPERATION_ADD,
-				fileName,
-				strings.TrimSpace(fileContent),
-			)
+			stats := gptHelper.GetStats(cmd.Context())
+			printStats(stats)
+			printDryRunPlan(stats)
+			return nil
+		}
+
+		if jsonOutput {
+			candidates, err := finalizeCandidates(cmd.Context(), gptHelper, summary, hints, numCandidates)
 			if err != nil {
 				return err
 			}
 
-			changeSummaries = append(changeSummaries, summary)
+			stats := gptHelper.GetStats(cmd.Context())
+			printStats(stats)
+
+			return printJSON(commitOutput{
+				Candidates: candidates,
+				Usage:      newUsageOutput(stats),
+			})
 		}
 
-		for _, fileName := range removedFiles {
-			if utils.IsBinaryFile(fileName) {
-				changeSummaries = append(changeSummaries, fmt.Sprintf("Removed binary file `%s`", fileName))
-				continue
-			}
+		interactive := !viper.GetBool("commit.preview") && utils.IsInteractive()
+
+		var lines *lineReader
+		if interactive {
+			lines = newLineReader(os.Stdin)
+		}
 
-			fileContent, err := gitHelper.ShowDeletedFile(fileName)
+		var commitMessage string
+		if numCandidates > 1 {
+			candidates, err := finalizeCandidates(cmd.Context(), gptHelper, summary, hints, numCandidates)
 			if err != nil {
 				return err
 			}
-
-			summary, err := gptHelper.SummarizeFile(
-				cmd.Context(),
-				git.OPERATION_DEL,
-				fileName,
-				strings.TrimSpace(fileContent),
-			)
+			printCandidates(candidates)
+
+			commitMessage = candidates[0]
+			if interactive {
+				commitMessage, err = pickCandidate(cmd.Context(), lines, candidates)
+				if err != nil {
+					return err
+				}
+			}
+		} else {
+			commitMessage, err = finalizeCommitMsg(cmd.Context(), gptHelper, summary, hints, stream)
 			if err != nil {
 				return err
 			}
-
-			changeSummaries = append(changeSummaries, summary)
 		}
 
-		for _, fileName := range modifiedFiles {
-			if utils.IsBinaryFile(fileName) {
-				changeSummaries = append(changeSummaries, fmt.Sprintf("Replaced binary file `%s`", fileName))
-				continue
-			}
+		printStats(gptHelper.GetStats(cmd.Context()))
 
-			diff, err := gitHelper.DiffFile(fileName)
+		if interactive {
+			var accepted bool
+			commitMessage, accepted, err = confirmCommitMessage(
+				cmd.Context(),
+				lines,
+				gitHelper,
+				commitMessage,
+				func(instruction string) (string, error) {
+					hints.Instruction = instruction
+					return finalizeCommitMsg(cmd.Context(), gptHelper, summary, hints, stream)
+				},
+			)
 			if err != nil {
 				return err
 			}
-
-			summary, err := gptHelper.SummarizeDiff(cmd.Context(), fileName, diff)
-			if err != nil {
-				return err
+			if !accepted {
+				color.Red("Aborted, nothing was committed")
+				return nil
 			}
-
-			changeSummaries = append(changeSummaries, summary)
 		}
 
-		summary, err := gptHelper.SummarizeChanges(cmd.Context(), changeSummaries)
-		if err != nil {
-			return err
-		}
-
-		commitMessage, err := gptHelper.FinalizeCommitMsg(cmd.Context(), summary)
-		if err != nil {
-			return err
-		}
-
-		// unescape html entities in commit message
-		commitMessage = html.UnescapeString(commitMessage)
-
-		// Output commit summary data from AI
-		color.Yellow("================Commit Summary====================")
-		color.Yellow("\n" + strings.TrimSpace(commitMessage) + "\n\n")
-		color.Yellow("==================================================")
-
-		stats := gptHelper.GetStats(cmd.Context())
-		color.Magenta(stats.String())
-
-		// pricePerThousand := 0.0
-		// if tmp, ok := costMap[selectedModel]; ok {
-		// 	pricePerThousand = tmp
-		// }
-		// if pricePerThousand > 0.0 {
-		// 	color.Magenta(
-		// 		"Total cost: ~$%.2f\n",
-		// 		calculateCost(totalTokens, pricePerThousand),
-		// 	)
-		// } else {
-		// 	color.Magenta("Unknown cost\n")
-		// }
-
 		outputFile := viper.GetString("commit.file")
 		if outputFile == "" {
 			out, err := gitHelper.GitDir()
@@ -229,7 +259,11 @@ var commitCmd = &cobra.Command{
 
 		// git commit automatically
 		color.Cyan("Git record changes to the repository")
-		output, err := gitHelper.Commit(commitMessage)
+		commit := gitHelper.Commit
+		if amend {
+			commit = gitHelper.Amend
+		}
+		output, err := commit(commitMessage)
 		if err != nil {
 			return err
 		}
@@ -238,3 +272,60 @@ var commitCmd = &cobra.Command{
 		return nil
 	},
 }
+
+// commitOutput is the result of commit --output json.
+type commitOutput struct {
+	Candidates []string    `json:"candidates"`
+	Usage      usageOutput `json:"usage"`
+}
+
+// finalizeCandidates generates several alternative commit messages.
+func finalizeCandidates(ctx context.Context, gptHelper gpt.Gpt, summary string, hints gpt.CommitHints, n int) ([]string, error) {
+	candidates, err := gptHelper.FinalizeCommitMsgCandidates(ctx, summary, hints, n)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, candidate := range candidates {
+		candidates[i] = strings.TrimSpace(candidate)
+	}
+
+	return candidates, nil
+}
+
+// printCandidates shows the candidate commit messages next to each other, numbered for picking.
+func printCandidates(candidates []string) {
+	for i, candidate := range candidates {
+		color.Yellow("================Candidate %d/%d====================", i+1, len(candidates))
+		color.Yellow("\n" + candidate + "\n\n")
+	}
+	color.Yellow("==================================================")
+}
+
+// finalizeCommitMsg generates the final commit message from the summary and prints it.
+func finalizeCommitMsg(ctx context.Context, gptHelper gpt.Gpt, summary string, hints gpt.CommitHints, stream bool) (string, error) {
+	// A streamed message is rendered while it arrives, so the header has to come first.
+	if stream {
+		color.Yellow("================Commit Summary====================\n")
+	}
+
+	commitMessage, err := gptHelper.FinalizeCommitMsg(ctx, summary, hints)
+	if err != nil {
+		return "", err
+	}
+
+	// Output commit summary data from AI
+	if stream {
+		color.Yellow("\n==================================================")
+	} else {
+		printCommitMessage(commitMessage)
+	}
+
+	return commitMessage, nil
+}
+
+func printCommitMessage(commitMessage string) {
+	color.Yellow("================Commit Summary====================")
+	color.Yellow("\n" + strings.TrimSpace(commitMessage) + "\n\n")
+	color.Yellow("==================================================")
+}
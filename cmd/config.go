@@ -23,39 +23,368 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/fatih/color"
+	"github.com/rammstein4o/git-gpt/gpt"
+	"github.com/rammstein4o/git-gpt/redact"
+	"github.com/rammstein4o/git-gpt/utils"
+	"github.com/sashabaranov/go-openai"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-func initConfig() {
-	// Find home directory.
+// Scopes of the configuration layers, from the lowest to the highest priority.
+const (
+	CONFIG_SCOPE_DEFAULT = "default"
+	CONFIG_SCOPE_USER    = "user"
+	CONFIG_SCOPE_REPO    = "repo"
+	CONFIG_SCOPE_ENV     = "env"
+	CONFIG_SCOPE_FLAG    = "flag"
+)
+
+// envPrefix is the prefix of the environment variables overriding the configuration, e.g. GIT_GPT_OPEN_AI_API_KEY.
+const envPrefix = "GIT_GPT"
+
+// repoConfigFile is the configuration shared through the repository, relative to its root.
+const repoConfigFile = ".git-gpt.yaml"
+
+// repoConfigKeys are the only keys the repository file may set, together with everything below them.
+// A cloned repository must not be able to pick the provider, point it to another endpoint or loosen redaction,
+// so it may add deny patterns but never allow patterns.
+var repoConfigKeys = []string{
+	"commit.style",
+	"commit.language",
+	"commit.scopes",
+	"git.exclude_list",
+	"redact.deny",
+}
+
+// repoAdditiveKeys are lists the repository file extends instead of replacing, so it cannot drop a user entry.
+var repoAdditiveKeys = []string{
+	"redact.deny",
+}
+
+// isRepoConfigKey tells whether the repository file may set the key.
+func isRepoConfigKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, allowed := range repoConfigKeys {
+		if key == allowed || strings.HasPrefix(key, allowed+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// setNested sets the dotted key in the values, nested the way MergeConfigMap expects the layout of a file.
+func setNested(values map[string]interface{}, key string, value interface{}) {
+	parts := strings.Split(key, ".")
+	section := values
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := section[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			section[part] = next
+		}
+		section = next
+	}
+	section[parts[len(parts)-1]] = value
+}
+
+// filterRepoConfig returns the values of the repository file it is allowed to set, and the keys that are ignored.
+func filterRepoConfig(v *viper.Viper) (map[string]interface{}, []string) {
+	values := make(map[string]interface{})
+	for _, key := range repoConfigKeys {
+		if !v.IsSet(key) {
+			continue
+		}
+
+		setNested(values, key, v.Get(key))
+	}
+
+	var ignored []string
+	for _, key := range v.AllKeys() {
+		if !isRepoConfigKey(key) {
+			ignored = append(ignored, key)
+		}
+	}
+	sort.Strings(ignored)
+
+	return values, ignored
+}
+
+// configFile is a configuration file that was loaded.
+type configFile struct {
+	scope string
+	path  string
+}
+
+// loadedConfigFiles lists the configuration files in the order they were merged.
+var loadedConfigFiles []configFile
+
+// userConfigFile returns the configuration file of the user: $XDG_CONFIG_HOME/git-gpt/config.yaml,
+// ~/.git-gpt.yaml or the legacy ~/.git-gpt, whichever exists first. The first one is returned if none exists.
+func userConfigFile() (string, error) {
+	candidates := make([]string, 0, 3)
+
+	configDir, err := utils.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	candidates = append(candidates, filepath.Join(configDir, "config.yaml"))
+
 	home, err := os.UserHomeDir()
-	cobra.CheckErr(err)
+	if err != nil {
+		return "", err
+	}
+	candidates = append(candidates, filepath.Join(home, ".git-gpt.yaml"), filepath.Join(home, ".git-gpt"))
+
+	for _, file := range candidates {
+		if utils.IsFile(file) {
+			return file, nil
+		}
+	}
+	return candidates[0], nil
+}
+
+// repoConfigPath returns the path of the configuration file of the current repository.
+func repoConfigPath() (string, error) {
+	root, err := utils.GitRoot()
+	if err != nil {
+		return "", err
+	}
 
-	// Search config in home directory with name ".git-gpt" (without extension).
-	viper.AddConfigPath(home)
+	return filepath.Join(root, repoConfigFile), nil
+}
+
+// knownConfigKeys lists the keys read by the commands, so they can be set through the environment alone.
+var knownConfigKeys = []string{
+	"mode",
+	"open_ai.api_key",
+	"open_ai.model",
+	"azure_open_ai.api_key",
+	"azure_open_ai.endpoint",
+	"azure_open_ai.model",
+	"azure_open_ai.alias",
+	"ollama.endpoint",
+	"ollama.model",
+	"heuristic.fallback",
+	"redact.enabled",
+	"redact.allow",
+	"redact.deny",
+	"redact.entropy",
+	"redact.strict",
+	"completion.max_tokens",
+	"completion.stream",
+	"completion.temperature",
+	"completion.top_p",
+	"commit.candidates",
+	"commit.concurrency",
+	"commit.file",
+	"commit.language",
+	"commit.max_cost",
+	"commit.output",
+	"commit.preview",
+	"commit.scopes",
+	"commit.style",
+	"cache.disabled",
+	"changelog.file",
+	"git.exclude_list",
+	"pr.base",
+	"pr.file",
+	"request.max_retries",
+	"request.timeout",
+	"request.total_timeout",
+}
+
+// setConfigDefaults registers the built-in defaults, the lowest configuration layer.
+func setConfigDefaults() {
+	viper.SetDefault("mode", "open_ai")
+	viper.SetDefault("open_ai.model", openai.GPT3Dot5Turbo)
+	viper.SetDefault("ollama.endpoint", gpt.DefaultOllamaEndpoint)
+	viper.SetDefault("completion.temperature", 0.4)
+	viper.SetDefault("completion.top_p", 1.0)
+	viper.SetDefault("request.max_retries", gpt.DefaultMaxRetries)
+	viper.SetDefault("request.timeout", gpt.DefaultRequestTimeout)
+	viper.SetDefault("heuristic.fallback", true)
+	viper.SetDefault("redact.enabled", true)
+	viper.SetDefault("redact.entropy", redact.DefaultEntropy)
+}
+
+// initConfig layers the configuration: the built-in defaults, the file of the user, the file of the repository,
+// the GIT_GPT_* environment variables and finally the flags. Missing files are skipped.
+func initConfig() {
 	viper.SetConfigType("yaml")
-	viper.SetConfigName(".git-gpt")
 
-	cobra.CheckErr(viper.ReadInConfig())
+	files := make([]configFile, 0, 2)
+	if file, err := userConfigFile(); err == nil {
+		files = append(files, configFile{scope: CONFIG_SCOPE_USER, path: file})
+	}
+	if file, err := repoConfigPath(); err == nil {
+		files = append(files, configFile{scope: CONFIG_SCOPE_REPO, path: file})
+	}
+
+	for _, file := range files {
+		if !utils.IsFile(file.path) {
+			continue
+		}
+
+		if file.scope == CONFIG_SCOPE_REPO {
+			mergeRepoConfig(file.path)
+		} else {
+			viper.SetConfigFile(file.path)
+			if err := viper.MergeInConfig(); err != nil {
+				cobra.CheckErr(fmt.Errorf("reading %s: %w", file.path, err))
+			}
+		}
+		loadedConfigFiles = append(loadedConfigFiles, file)
+	}
+
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+
+	// AutomaticEnv only answers lookups, binding the keys set in the environment lists them as well.
+	for _, key := range knownConfigKeys {
+		if _, ok := os.LookupEnv(envKey(key)); ok {
+			viper.BindEnv(key)
+		}
+	}
+}
+
+// mergeRepoConfig merges the keys the repository file is allowed to set and warns about the others.
+func mergeRepoConfig(path string) {
+	v, err := readConfigFile(path)
+	cobra.CheckErr(err)
+
+	values, ignored := filterRepoConfig(v)
+	for _, key := range repoAdditiveKeys {
+		if v.IsSet(key) {
+			setNested(values, key, append(viper.GetStringSlice(key), v.GetStringSlice(key)...))
+		}
+	}
+	if len(ignored) > 0 {
+		fmt.Fprintln(os.Stderr, color.YellowString(
+			"Warning: ignoring %s in %s, a repository may only set %s",
+			strings.Join(ignored, ", "), path, strings.Join(repoConfigKeys, ", "),
+		))
+	}
+
+	cobra.CheckErr(viper.MergeConfigMap(values))
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
 
+	setConfigDefaults()
+
+	rootCmd.PersistentFlags().Duration("timeout", 0, "give up the whole run after this long, 0 disables the limit")
+	viper.BindPFlag("request.total_timeout", rootCmd.PersistentFlags().Lookup("timeout"))
+
+	rootCmd.PersistentFlags().Bool("strict", false, "abort when a file or diff contains a possible secret instead of redacting it")
+	viper.BindPFlag("redact.strict", rootCmd.PersistentFlags().Lookup("strict"))
+
 	commitCmd.PersistentFlags().StringP("file", "f", "", "commit message file")
 	viper.BindPFlag("commit.file", commitCmd.PersistentFlags().Lookup("file"))
 
 	commitCmd.PersistentFlags().Bool("preview", false, "preview commit message")
 	viper.BindPFlag("commit.preview", commitCmd.PersistentFlags().Lookup("preview"))
 
-	commitCmd.PersistentFlags().Int("maxChunkSize", 6000, "split big diffs into chunks with this maximum size")
+	commitCmd.PersistentFlags().Int("maxChunkSize", 2000, "split big diffs and files into chunks of at most this many tokens")
 	viper.BindPFlag("commit.maxChunkSize", commitCmd.PersistentFlags().Lookup("maxChunkSize"))
 
+	commitCmd.PersistentFlags().String("style", "", "commit message style, set to \"conventional\" for Conventional Commits")
+	viper.BindPFlag("commit.style", commitCmd.PersistentFlags().Lookup("style"))
+
+	commitCmd.PersistentFlags().String("lang", "", "language of the commit message as a locale code, e.g. de, ja or pt-BR")
+	viper.BindPFlag("commit.language", commitCmd.PersistentFlags().Lookup("lang"))
+
+	reviewCmd.Flags().String("lang", "", "language of the review as a locale code, e.g. de, ja or pt-BR")
+
+	commitCmd.PersistentFlags().Bool("stream", false, "render the commit message while it is generated")
+	viper.BindPFlag("completion.stream", commitCmd.PersistentFlags().Lookup("stream"))
+
+	commitCmd.PersistentFlags().Int("concurrency", 4, "maximum number of files summarized in parallel")
+	viper.BindPFlag("commit.concurrency", commitCmd.PersistentFlags().Lookup("concurrency"))
+
+	commitCmd.PersistentFlags().Float64("max-cost", 0, "abort before a request could bring the estimated spend over this many USD, 0 disables the limit")
+	viper.BindPFlag("commit.max_cost", commitCmd.PersistentFlags().Lookup("max-cost"))
+
+	commitCmd.PersistentFlags().Int("candidates", 1, "generate this many alternative commit messages to pick from")
+	viper.BindPFlag("commit.candidates", commitCmd.PersistentFlags().Lookup("candidates"))
+
+	commitCmd.PersistentFlags().String("output", OUTPUT_TEXT, "output format, \"json\" prints the candidates instead of committing")
+	viper.BindPFlag("commit.output", commitCmd.PersistentFlags().Lookup("output"))
+
+	commitCmd.PersistentFlags().Bool("no-cache", false, "do not reuse or store per-file summaries")
+	viper.BindPFlag("cache.disabled", commitCmd.PersistentFlags().Lookup("no-cache"))
+
+	commitCmd.Flags().Bool("dry-run", false, "print every prompt with its token estimate and the plan instead of calling the API")
+	commitCmd.Flags().Bool("amend", false, "replace the last commit, describing its changes together with the newly staged ones")
+
+	rewordCmd.Flags().Bool("apply", false, "rewrite the commits with the suggested messages")
+	rewordCmd.Flags().Bool("force", false, "rewrite ranges with merges or commits that were already pushed")
+	rewordCmd.Flags().String("lang", "", "language of the messages as a locale code, e.g. de, ja or pt-BR")
+
+	prCmd.Flags().String("base", "", "branch the pull request is opened against, defaults to the default branch of origin, main or master")
+	viper.BindPFlag("pr.base", prCmd.Flags().Lookup("base"))
+
+	prCmd.Flags().StringP("file", "f", "", "write the description to this file instead of stdout")
+	viper.BindPFlag("pr.file", prCmd.Flags().Lookup("file"))
+
+	prCmd.Flags().String("lang", "", "language of the description as a locale code, e.g. de, ja or pt-BR")
+
+	changelogCmd.Flags().String("version", "", "version of the section heading, \"Unreleased\" when empty")
+	changelogCmd.Flags().String("date", "", "release date of the section heading, defaults to today")
+	changelogCmd.Flags().StringP("file", "f", "", "prepend the section to this changelog instead of printing it, e.g. CHANGELOG.md")
+	viper.BindPFlag("changelog.file", changelogCmd.Flags().Lookup("file"))
+	changelogCmd.Flags().String("lang", "", "language of the classified entries as a locale code, e.g. de, ja or pt-BR")
+
+	cacheGcCmd.Flags().Duration("max-age", 30*24*time.Hour, "remove summaries not used for longer than this")
+
+	configListCmd.Flags().Bool("show-origin", false, "show the layer and the file each value comes from")
+	// The provider settings asked by config init cannot be stored in the repository.
+	configSetCmd.Flags().Bool("repo", false, "write to .git-gpt.yaml of the repository")
+	for _, c := range []*cobra.Command{configSetCmd, configInitCmd} {
+		c.Flags().Bool("global", false, "write to the configuration of the user (default)")
+	}
+
+	configCmd.AddCommand(configInitCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configListCmd)
+
+	templatesExportCmd.Flags().Bool("force", false, "replace templates that already exist in the directory")
+
+	templatesCmd.AddCommand(templatesListCmd)
+	templatesCmd.AddCommand(templatesExportCmd)
+	templatesCmd.AddCommand(templatesCheckCmd)
+
+	cacheCmd.AddCommand(cacheStatsCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+	cacheCmd.AddCommand(cacheGcCmd)
+
+	hookInstallCmd.Flags().Bool("force", false, "replace a prepare-commit-msg hook not installed by git-gpt")
+	hookUninstallCmd.Flags().Bool("force", false, "remove the prepare-commit-msg hook even if it was not installed by git-gpt")
+
+	hookCmd.AddCommand(hookInstallCmd)
+	hookCmd.AddCommand(hookUninstallCmd)
+	hookCmd.AddCommand(hookStatusCmd)
+
 	rootCmd.AddCommand(commitCmd)
 	rootCmd.AddCommand(hookCmd)
 	rootCmd.AddCommand(reviewCmd)
+	rootCmd.AddCommand(rewordCmd)
+	rootCmd.AddCommand(prCmd)
+	rootCmd.AddCommand(changelogCmd)
+	rootCmd.AddCommand(modelsCmd)
+	rootCmd.AddCommand(cacheCmd)
+	rootCmd.AddCommand(templatesCmd)
+	rootCmd.AddCommand(configCmd)
 	rootCmd.AddCommand(completionCmd)
 }
@@ -0,0 +1,528 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/rammstein4o/git-gpt/gpt"
+	"github.com/rammstein4o/git-gpt/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// configSections are the known top-level sections of the configuration.
+var configSections = []string{
+	"mode",
+	"open_ai",
+	"azure_open_ai",
+	"ollama",
+	"heuristic",
+	"redact",
+	"completion",
+	"commit",
+	"cache",
+	"git",
+	"models",
+	"request",
+}
+
+// isSecretKey tells whether the value of the key must never be shown in full.
+func isSecretKey(key string) bool {
+	parts := strings.Split(strings.ToLower(key), ".")
+	name := parts[len(parts)-1]
+
+	if name == "token" || strings.HasSuffix(name, "_token") {
+		return true
+	}
+	for _, marker := range []string{"api_key", "apikey", "secret", "password"} {
+		if strings.Contains(name, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskSecret hides all but the first three and the last four characters of a secret.
+func maskSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) <= 10 {
+		return strings.Repeat("*", len(value))
+	}
+	return value[:3] + strings.Repeat("*", len(value)-7) + value[len(value)-4:]
+}
+
+// formatConfigValue renders a value for the output, masking secrets.
+func formatConfigValue(key string, value interface{}) string {
+	value = maskConfigValue(key, value)
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case []interface{}, []string, map[string]interface{}:
+		out, err := yaml.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return strings.TrimSpace(string(out))
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// maskConfigValue masks the secrets of the value, walking nested sections so a whole section can be shown.
+func maskConfigValue(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		masked := make(map[string]interface{}, len(v))
+		for name, nested := range v {
+			masked[name] = maskConfigValue(key+"."+name, nested)
+		}
+		return masked
+	case map[interface{}]interface{}:
+		masked := make(map[string]interface{}, len(v))
+		for name, nested := range v {
+			masked[fmt.Sprint(name)] = maskConfigValue(key+"."+fmt.Sprint(name), nested)
+		}
+		return masked
+	}
+
+	if isSecretKey(key) {
+		return maskSecret(fmt.Sprint(value))
+	}
+	return value
+}
+
+// envKey returns the environment variable overriding the key.
+func envKey(key string) string {
+	return envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// configOrigin tells which layer the effective value of the key comes from, and the file for file layers.
+func configOrigin(key string, files map[string]*viper.Viper) (string, string) {
+	if _, ok := os.LookupEnv(envKey(key)); ok {
+		return CONFIG_SCOPE_ENV, envKey(key)
+	}
+
+	// The files were merged in order, so the last one setting the key wins.
+	for i := len(loadedConfigFiles) - 1; i >= 0; i-- {
+		file := loadedConfigFiles[i]
+		if v, ok := files[file.path]; ok && v.IsSet(key) {
+			return file.scope, file.path
+		}
+	}
+
+	return CONFIG_SCOPE_DEFAULT, ""
+}
+
+// readConfigFiles reads every loaded configuration file on its own, to find out where values come from.
+func readConfigFiles() (map[string]*viper.Viper, error) {
+	files := make(map[string]*viper.Viper, len(loadedConfigFiles))
+	for _, file := range loadedConfigFiles {
+		v, err := readConfigFile(file.path)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only what the repository file may set counts as coming from it.
+		if file.scope == CONFIG_SCOPE_REPO {
+			values, _ := filterRepoConfig(v)
+			v = viper.New()
+			if err := v.MergeConfigMap(values); err != nil {
+				return nil, err
+			}
+		}
+		files[file.path] = v
+	}
+	return files, nil
+}
+
+// readConfigFile reads a single configuration file, a missing file gives an empty configuration.
+func readConfigFile(path string) (*viper.Viper, error) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.SetConfigFile(path)
+
+	if utils.IsFile(path) {
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+	}
+	return v, nil
+}
+
+// parseConfigValue interprets a value given on the command line as YAML, so numbers, booleans and lists keep their type.
+func parseConfigValue(raw string) interface{} {
+	var value interface{}
+	if err := yaml.Unmarshal([]byte(raw), &value); err != nil || value == nil {
+		return raw
+	}
+	if _, ok := value.(map[string]interface{}); ok {
+		return raw
+	}
+	return value
+}
+
+// configTarget returns the file changed by config set and config init, the user file unless --repo is given.
+func configTarget(cmd *cobra.Command) (string, string, error) {
+	repo, _ := cmd.Flags().GetBool("repo")
+	global, _ := cmd.Flags().GetBool("global")
+	if repo && global {
+		return "", "", fmt.Errorf("--repo and --global cannot be used together")
+	}
+
+	if repo {
+		path, err := repoConfigPath()
+		return CONFIG_SCOPE_REPO, path, err
+	}
+
+	path, err := userConfigFile()
+	return CONFIG_SCOPE_USER, path, err
+}
+
+// writeConfigValues sets the values in the configuration file, keeping everything else it contains.
+// Secrets are refused for the repository file, which is usually committed.
+func writeConfigValues(scope, path string, values map[string]interface{}) error {
+	for key := range values {
+		if scope == CONFIG_SCOPE_REPO && isSecretKey(key) {
+			return fmt.Errorf("refusing to store %s in the repository configuration, use --global or %s", key, envKey(key))
+		}
+		if scope == CONFIG_SCOPE_REPO && !isRepoConfigKey(key) {
+			return fmt.Errorf("%s cannot be set by the repository configuration, it may only set %s", key, strings.Join(repoConfigKeys, ", "))
+		}
+	}
+
+	v, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	for key, value := range values {
+		v.Set(key, value)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// The user file holds the API keys, create it readable by the user alone before anything is written to it.
+	if scope == CONFIG_SCOPE_USER {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o600)
+		if err != nil {
+			return err
+		}
+		file.Close()
+		if err := os.Chmod(path, 0o600); err != nil {
+			return err
+		}
+	}
+
+	return v.WriteConfigAs(path)
+}
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show and change the configuration",
+	Long: `Show and change the configuration.
+
+The configuration is layered, from the lowest to the highest priority:
+  1. built-in defaults
+  2. $XDG_CONFIG_HOME/git-gpt/config.yaml, ~/.git-gpt.yaml or ~/.git-gpt
+  3. .git-gpt.yaml at the root of the repository, limited to commit.style, commit.language,
+     commit.scopes, git.exclude_list and redact.deny, which extends the patterns of the user
+  4. GIT_GPT_* environment variables, e.g. GIT_GPT_OPEN_AI_API_KEY
+  5. flags`,
+}
+
+// configGetCmd represents the config get command
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the effective value of a key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := strings.ToLower(args[0])
+		if !viper.IsSet(key) {
+			return fmt.Errorf("%s is not set", key)
+		}
+
+		fmt.Println(formatConfigValue(key, viper.Get(key)))
+		return nil
+	},
+}
+
+// configSetCmd represents the config set command
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Store a value in the user configuration, or in the repository one with --repo",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := strings.ToLower(args[0])
+
+		section := strings.SplitN(key, ".", 2)[0]
+		known := false
+		for _, s := range configSections {
+			known = known || s == section
+		}
+		if !known {
+			color.Yellow("Warning: %s is not a known section of the configuration", section)
+		}
+
+		scope, path, err := configTarget(cmd)
+		if err != nil {
+			return err
+		}
+
+		value := parseConfigValue(args[1])
+		if err := writeConfigValues(scope, path, map[string]interface{}{key: value}); err != nil {
+			return err
+		}
+
+		color.Green("Set %s = %s in %s", key, formatConfigValue(key, value), path)
+		return nil
+	},
+}
+
+// configListCmd represents the config list command
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the effective configuration",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		showOrigin, _ := cmd.Flags().GetBool("show-origin")
+
+		files, err := readConfigFiles()
+		if err != nil {
+			return err
+		}
+
+		keys := viper.AllKeys()
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			value := formatConfigValue(key, viper.Get(key))
+			if !showOrigin {
+				fmt.Printf("%s=%s\n", key, value)
+				continue
+			}
+
+			scope, source := configOrigin(key, files)
+			origin := scope
+			if source != "" {
+				origin += ":" + source
+			}
+			fmt.Printf("%-48s %s=%s\n", color.CyanString(origin), key, value)
+		}
+		return nil
+	},
+}
+
+// configInitCmd represents the config init command
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the configuration interactively",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !utils.IsInteractive() {
+			return fmt.Errorf("config init needs a terminal, use config set instead")
+		}
+
+		scope, path, err := configTarget(cmd)
+		if err != nil {
+			return err
+		}
+
+		w := &configWizard{
+			ctx:   cmd.Context(),
+			lines: newLineReader(os.Stdin),
+		}
+
+		values, err := w.run()
+		if err != nil {
+			return err
+		}
+
+		if err := writeConfigValues(scope, path, values); err != nil {
+			return err
+		}
+
+		color.Green("Wrote the configuration to %s", path)
+		return nil
+	},
+}
+
+// configWizard asks the questions of config init.
+type configWizard struct {
+	ctx   context.Context
+	lines *lineReader
+}
+
+// ask prints the question and returns the answer, or the default for an empty answer.
+func (w *configWizard) ask(question, def string) (string, error) {
+	if def != "" {
+		color.Cyan("%s [%s]", question, def)
+	} else {
+		color.Cyan(question)
+	}
+	fmt.Print("> ")
+
+	answer, err := w.lines.readLine(w.ctx)
+	if err != nil {
+		return "", err
+	}
+
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+// choose lets the user pick one of the options by number or by typing a value.
+func (w *configWizard) choose(question string, options []string, def string) (string, error) {
+	for i, option := range options {
+		fmt.Printf("  %2d) %s\n", i+1, option)
+	}
+
+	answer, err := w.ask(question, def)
+	if err != nil {
+		return "", err
+	}
+
+	if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(options) {
+		return options[n-1], nil
+	}
+	return answer, nil
+}
+
+// askSecret asks for an API key, leaving it empty falls back to the environment.
+func (w *configWizard) askSecret(key string) (string, error) {
+	// Keep the key off the screen while it is typed.
+	if err := utils.SetEcho(false); err == nil {
+		defer func() {
+			_ = utils.SetEcho(true)
+			fmt.Println()
+		}()
+	}
+
+	return w.ask(fmt.Sprintf("API key (leave empty to use %s)", envKey(key)), "")
+}
+
+// catalogModels lists the models of the built-in catalog.
+func catalogModels() []string {
+	models := make([]string, 0, len(gpt.DefaultModels))
+	for name := range gpt.DefaultModels {
+		models = append(models, name)
+	}
+	sort.Strings(models)
+	return models
+}
+
+func (w *configWizard) run() (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	mode, err := w.choose("Provider", []string{"open_ai", "azure_open_ai", "ollama", "heuristic"}, "open_ai")
+	if err != nil {
+		return nil, err
+	}
+	values["mode"] = mode
+
+	switch mode {
+	case "open_ai":
+		key, err := w.askSecret("open_ai.api_key")
+		if err != nil {
+			return nil, err
+		}
+		if key != "" {
+			values["open_ai.api_key"] = key
+		}
+
+		model, err := w.choose("Model", catalogModels(), viper.GetString("open_ai.model"))
+		if err != nil {
+			return nil, err
+		}
+		values["open_ai.model"] = model
+	case "azure_open_ai":
+		key, err := w.askSecret("azure_open_ai.api_key")
+		if err != nil {
+			return nil, err
+		}
+		if key != "" {
+			values["azure_open_ai.api_key"] = key
+		}
+
+		endpoint, err := w.ask("Endpoint, e.g. https://<resource>.openai.azure.com/", viper.GetString("azure_open_ai.endpoint"))
+		if err != nil {
+			return nil, err
+		}
+		values["azure_open_ai.endpoint"] = endpoint
+
+		model, err := w.choose("Model", catalogModels(), viper.GetString("azure_open_ai.model"))
+		if err != nil {
+			return nil, err
+		}
+		values["azure_open_ai.model"] = model
+
+		alias, err := w.ask("Deployment name, if it differs from the model", viper.GetString("azure_open_ai.alias"))
+		if err != nil {
+			return nil, err
+		}
+		if alias != "" {
+			values["azure_open_ai.alias"] = alias
+		}
+	case "ollama":
+		endpoint, err := w.ask("Endpoint", viper.GetString("ollama.endpoint"))
+		if err != nil {
+			return nil, err
+		}
+		values["ollama.endpoint"] = endpoint
+
+		// Offer the models the server has pulled, if it is reachable.
+		models, err := gpt.NewOllama(endpoint, nil).ListModels(w.ctx)
+		if err != nil {
+			color.Yellow("Could not list the models of %s: %v", endpoint, err)
+		}
+		sort.Strings(models)
+
+		model, err := w.choose("Model", models, viper.GetString("ollama.model"))
+		if err != nil {
+			return nil, err
+		}
+		values["ollama.model"] = model
+	case "heuristic":
+		// The offline generator has nothing to configure.
+	default:
+		return nil, fmt.Errorf("unknown provider %q", mode)
+	}
+
+	return values, nil
+}
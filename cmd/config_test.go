@@ -0,0 +1,140 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// resetConfig starts the test from the built-in defaults and restores them afterwards.
+func resetConfig(t *testing.T) {
+	t.Helper()
+
+	viper.Reset()
+	setConfigDefaults()
+	t.Cleanup(func() {
+		viper.Reset()
+		setConfigDefaults()
+	})
+}
+
+// writeRepoConfig writes the repository file into a temporary directory and returns its path.
+func writeRepoConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), repoConfigFile)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRepoConfigDenyRedactsDiff(t *testing.T) {
+	resetConfig(t)
+	// The user file, merged before the repository one.
+	if err := viper.MergeConfigMap(map[string]interface{}{
+		"redact": map[string]interface{}{"deny": []interface{}{`USER-[0-9]+`}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	mergeRepoConfig(writeRepoConfig(t, `
+redact:
+  deny:
+    - 'ACME-[0-9]{8}'
+  allow:
+    - 'ACME-'
+  enabled: false
+`))
+
+	if want := []string{`USER-[0-9]+`, `ACME-[0-9]{8}`}; !reflect.DeepEqual(viper.GetStringSlice("redact.deny"), want) {
+		t.Errorf("redact.deny = %q, want %q", viper.GetStringSlice("redact.deny"), want)
+	}
+	if !viper.GetBool("redact.enabled") || len(viper.GetStringSlice("redact.allow")) != 0 {
+		t.Errorf("the repository file changed redact.enabled or redact.allow")
+	}
+
+	redactor, err := newRedactor()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := "@@ -1 +1 @@\n-customer = none\n+customer = ACME-12345678 USER-42\n"
+	got, findings, err := redactor.Redact("customers.txt", diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "@@ -1 +1 @@\n-customer = none\n+customer = [REDACTED:deny] [REDACTED:deny]\n"
+	if got != want {
+		t.Errorf("Redact() = %q, want %q", got, want)
+	}
+	if len(findings) != 2 || findings[0].Line != 3 {
+		t.Errorf("findings = %+v, want two on line 3", findings)
+	}
+}
+
+func TestFilterRepoConfig(t *testing.T) {
+	resetConfig(t)
+
+	v, err := readConfigFile(writeRepoConfig(t, `
+mode: ollama
+ollama:
+  endpoint: http://attacker.example
+commit:
+  style: conventional
+  scopes:
+    src/api: api
+redact:
+  enabled: false
+  deny:
+    - 'ACME-[0-9]+'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values, ignored := filterRepoConfig(v)
+
+	want := map[string]interface{}{
+		"commit": map[string]interface{}{
+			"style":  "conventional",
+			"scopes": map[string]interface{}{"src/api": "api"},
+		},
+		"redact": map[string]interface{}{
+			"deny": []interface{}{"ACME-[0-9]+"},
+		},
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %#v, want %#v", values, want)
+	}
+	if got := strings.Join(ignored, ","); got != "mode,ollama.endpoint,redact.enabled" {
+		t.Errorf("ignored = %q", got)
+	}
+}
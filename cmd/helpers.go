@@ -0,0 +1,321 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/rammstein4o/git-gpt/git"
+	"github.com/rammstein4o/git-gpt/gpt"
+	"github.com/rammstein4o/git-gpt/redact"
+	"github.com/rammstein4o/git-gpt/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// colorWriter writes everything in a single color, e.g. tokens streamed to the terminal.
+type colorWriter struct {
+	c *color.Color
+	w io.Writer
+}
+
+func newColorWriter(attrs ...color.Attribute) io.Writer {
+	return &colorWriter{
+		c: color.New(attrs...),
+		w: color.Output,
+	}
+}
+
+func (cw *colorWriter) Write(p []byte) (int, error) {
+	if _, err := cw.c.Fprint(cw.w, string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// newGitHelper creates the git helper configured from the loaded settings. Unless disabled, secrets are redacted
+// from every file content and diff before it can reach the model.
+func newGitHelper(opts ...git.Option) git.Git {
+	gitOptions := []git.Option{
+		git.WithExcludeList(viper.GetStringSlice("git.exclude_list")),
+	}
+
+	gitHelper := git.New(append(gitOptions, opts...)...)
+
+	if !viper.GetBool("redact.enabled") {
+		return gitHelper
+	}
+
+	redactor, err := newRedactor()
+	cobra.CheckErr(err)
+
+	return redact.NewGit(gitHelper, redactor, func(name string, findings []redact.Finding) {
+		rules := make([]string, 0, len(findings))
+		for _, finding := range findings {
+			rules = append(rules, finding.Rule)
+		}
+		color.Yellow("Redacted %d possible secret(s) in %s: %s", len(findings), name, strings.Join(rules, ", "))
+	})
+}
+
+// newRedactor creates the redactor configured from the loaded settings.
+func newRedactor() (*redact.Redactor, error) {
+	return redact.New(
+		redact.WithAllow(viper.GetStringSlice("redact.allow")),
+		redact.WithDeny(viper.GetStringSlice("redact.deny")),
+		redact.WithEntropy(viper.GetFloat64("redact.entropy")),
+		redact.WithStrict(viper.GetBool("redact.strict")),
+	)
+}
+
+// newGptHelper creates the gpt helper for the configured mode. Unless disabled, the offline heuristic answers
+// when the provider fails.
+func newGptHelper(opts ...gpt.Option) gpt.Gpt {
+	mode := viper.GetString("mode")
+	if mode == "heuristic" {
+		cobra.CheckErr(gpt.CheckHeuristicOptions(opts...))
+		return gpt.NewHeuristic(viper.GetString("commit.style"))
+	}
+
+	var topP float32
+	if err := viper.UnmarshalKey("completion.top_p", &topP); err != nil {
+		topP = 1.0
+	}
+
+	var temperature float32
+	if err := viper.UnmarshalKey("completion.temperature", &temperature); err != nil {
+		temperature = 0.4
+	}
+
+	var models map[string]gpt.ModelInfo
+	if err := viper.UnmarshalKey("models", &models); err != nil {
+		color.Red("Ignoring the invalid models configuration: %v", err)
+	}
+
+	gptOptions := []gpt.Option{
+		gpt.WithModels(models),
+		gpt.WithMaxTokens(viper.GetInt("completion.max_tokens")),
+		gpt.WithTopP(topP),
+		gpt.WithTemperature(temperature),
+		gpt.WithStream(viper.GetBool("completion.stream")),
+		gpt.WithMaxChunkSize(viper.GetInt("commit.maxChunkSize")),
+		gpt.WithMaxCost(viper.GetFloat64("commit.max_cost")),
+		gpt.WithMaxRetries(viper.GetInt("request.max_retries")),
+		gpt.WithRequestTimeout(viper.GetDuration("request.timeout")),
+		gpt.WithRetryNotify(func(attempt int, wait time.Duration, reason string) {
+			color.Yellow("Request failed (%s), retry %d in %s", reason, attempt, wait.Round(time.Millisecond))
+		}),
+		gpt.WithCommitStyle(viper.GetString("commit.style")),
+	}
+
+	switch mode {
+	case "azure_open_ai":
+		gptOptions = append(gptOptions, gpt.WithAzureOpenAI(
+			viper.GetString("azure_open_ai.api_key"),
+			viper.GetString("azure_open_ai.endpoint"),
+			viper.GetString("azure_open_ai.model"),
+			viper.GetString("azure_open_ai.alias"),
+		))
+	case "ollama":
+		gptOptions = append(gptOptions, gpt.WithOllama(
+			viper.GetString("ollama.endpoint"),
+			viper.GetString("ollama.model"),
+		))
+	default:
+		gptOptions = append(gptOptions, gpt.WithOpenAI(
+			viper.GetString("open_ai.api_key"),
+			viper.GetString("open_ai.model"),
+		))
+	}
+
+	gptHelper := gpt.New(
+		append(gptOptions, opts...)...,
+	)
+
+	if !viper.GetBool("heuristic.fallback") {
+		return gptHelper
+	}
+
+	return gpt.NewWithFallback(
+		gptHelper,
+		gpt.NewHeuristic(viper.GetString("commit.style")),
+		func(err error) {
+			color.Yellow("The provider failed (%v), falling back to the heuristic generator", err)
+		},
+	)
+}
+
+// outputLanguage validates the configured language of the generated texts, the flag of the command takes precedence.
+func outputLanguage(cmd *cobra.Command) (string, error) {
+	language := viper.GetString("commit.language")
+	if flag := cmd.Flags().Lookup("lang"); flag != nil && flag.Changed {
+		language = flag.Value.String()
+	}
+
+	return gpt.NormalizeLanguage(language)
+}
+
+// printStats prints the usage of the run, broken down by stage when the cost is known.
+func printStats(stats *gpt.Stats) {
+	color.Magenta(stats.String())
+	if !stats.CostKnown {
+		return
+	}
+	for _, stage := range stats.Stages() {
+		color.Magenta("  " + stage.String())
+	}
+}
+
+// printDryRunPlan sums up what a dry run would have sent, the cost assumes every answer uses all of its tokens.
+func printDryRunPlan(stats *gpt.Stats) {
+	cost := "unknown, the model has no pricing"
+	if stats.CostKnown {
+		cost = fmt.Sprintf("$%.4f", stats.Cost)
+	}
+
+	color.Cyan(
+		"Plan: %d request(s), ~%d prompt tokens, up to %d completion tokens, worst-case cost %s",
+		stats.NumRequests,
+		stats.PromptTokens,
+		stats.CompletionTokens,
+		cost,
+	)
+}
+
+// summarizeChange produces the summary of a single staged change.
+func summarizeChange(ctx context.Context, gitHelper git.Git, gptHelper gpt.Gpt, change git.StagedChange) (string, error) {
+	if utils.IsBinaryFile(change.Path) {
+		return gpt.DescribeChange(change) + " (binary)", nil
+	}
+
+	switch change.Kind {
+	case git.OPERATION_ADD:
+		fileContent, err := gitHelper.ShowStagedFile(change.Path)
+		if err != nil {
+			return "", err
+		}
+
+		return gptHelper.SummarizeFile(ctx, change, strings.TrimSpace(fileContent))
+	case git.OPERATION_DEL:
+		fileContent, err := gitHelper.ShowDeletedFile(change.Path)
+		if err != nil {
+			return "", err
+		}
+
+		return gptHelper.SummarizeFile(ctx, change, strings.TrimSpace(fileContent))
+	case git.OPERATION_RENAME, git.OPERATION_COPY:
+		// An exact rename or copy has no content changes worth asking about.
+		if change.Score >= 100 {
+			return gpt.DescribeChange(change), nil
+		}
+
+		diff, err := gitHelper.DiffMove(change.OldPath, change.Path)
+		if err != nil {
+			return "", err
+		}
+
+		return gptHelper.SummarizeDiff(ctx, change, diff)
+	default:
+		diff, err := gitHelper.DiffFile(change.Path)
+		if err != nil {
+			return "", err
+		}
+
+		return gptHelper.SummarizeDiff(ctx, change, diff)
+	}
+}
+
+// stagedChanges returns the staged changes and refuses to continue while there are unresolved conflicts.
+func stagedChanges(gitHelper git.Git) ([]git.StagedChange, error) {
+	changes, err := gitHelper.StagedChanges()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range changes {
+		if change.Kind == git.OPERATION_UNMERGED {
+			return nil, fmt.Errorf("unmerged path `%s`, please resolve the conflict first", change.Path)
+		}
+	}
+
+	return changes, nil
+}
+
+// summarizeStagedChanges summarizes every staged change using at most concurrency parallel requests.
+// The summaries keep the order of the staged changes regardless of which request finishes first.
+func summarizeStagedChanges(ctx context.Context, gitHelper git.Git, gptHelper gpt.Gpt, concurrency int) ([]git.StagedChange, []string, error) {
+	changes, err := stagedChanges(gitHelper)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	summaries := make([]string, len(changes))
+	err = utils.RunConcurrently(ctx, concurrency, len(changes), func(ctx context.Context, i int) error {
+		summary, err := summarizeChange(ctx, gitHelper, gptHelper, changes[i])
+		if err != nil {
+			return err
+		}
+		summaries[i] = summary
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return changes, summaries, nil
+}
+
+// commitHints derives the hints for the final commit message from the staged changes and their line counts.
+func commitHints(gitHelper git.Git, changes []git.StagedChange) (gpt.CommitHints, error) {
+	numStat, err := gitHelper.NumStat()
+	if err != nil {
+		return gpt.CommitHints{}, err
+	}
+
+	paths := make([]string, 0, len(changes))
+	for _, change := range changes {
+		if change.OldPath != "" {
+			paths = append(paths, change.OldPath)
+		}
+		paths = append(paths, change.Path)
+	}
+
+	hints := gpt.CommitHints{
+		Type:    gpt.InferCommitType(paths),
+		Scope:   gpt.InferScope(paths, viper.GetStringMapString("commit.scopes")),
+		Changes: changes,
+		NumStat: numStat,
+	}
+
+	// Avoid headers like "docs(docs): ..." when everything lives in a directory named after the type.
+	if hints.Scope == hints.Type {
+		hints.Scope = ""
+	}
+
+	return hints, nil
+}
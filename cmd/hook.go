@@ -25,20 +25,108 @@ package cmd
 import (
 	"fmt"
 
+	"github.com/fatih/color"
+	"github.com/rammstein4o/git-gpt/git"
+	"github.com/rammstein4o/git-gpt/utils"
 	"github.com/spf13/cobra"
 )
 
 // hookCmd represents the hook command
 var hookCmd = &cobra.Command{
 	Use:   "hook",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("hook called")
+	Short: "Manage the prepare-commit-msg hook",
+	Long: `Manage the prepare-commit-msg hook that generates a commit message
+every time you run a plain "git commit".
+
+The hook is installed into the directory configured by core.hooksPath,
+or into the hooks directory of the repository when it is not set.`,
+}
+
+// hookInstallCmd represents the hook install command
+var hookInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install the prepare-commit-msg hook",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := utils.CwdToGitRoot(); err != nil {
+			return err
+		}
+
+		gitHelper := git.New()
+
+		force, _ := cmd.Flags().GetBool("force")
+		if err := gitHelper.InstallHook(force); err != nil {
+			return err
+		}
+
+		target, err := gitHelper.HookPath()
+		if err != nil {
+			return err
+		}
+
+		color.Green("Installed the prepare-commit-msg hook to " + target)
+		return nil
+	},
+}
+
+// hookUninstallCmd represents the hook uninstall command
+var hookUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove the prepare-commit-msg hook",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := utils.CwdToGitRoot(); err != nil {
+			return err
+		}
+
+		gitHelper := git.New()
+
+		force, _ := cmd.Flags().GetBool("force")
+		if err := gitHelper.UninstallHook(force); err != nil {
+			return err
+		}
+
+		target, err := gitHelper.HookPath()
+		if err != nil {
+			return err
+		}
+
+		color.Green("Removed the prepare-commit-msg hook from " + target)
+		return nil
+	},
+}
+
+// hookStatusCmd represents the hook status command
+var hookStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the prepare-commit-msg hook is installed",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := utils.CwdToGitRoot(); err != nil {
+			return err
+		}
+
+		gitHelper := git.New()
+
+		target, err := gitHelper.HookPath()
+		if err != nil {
+			return err
+		}
+
+		state, err := gitHelper.HookStatus()
+		if err != nil {
+			return err
+		}
+
+		switch state {
+		case git.HOOK_INSTALLED:
+			color.Green("The git-gpt prepare-commit-msg hook is installed at " + target)
+		case git.HOOK_FOREIGN:
+			color.Yellow("A prepare-commit-msg hook not managed by git-gpt exists at " + target)
+		default:
+			fmt.Println("No prepare-commit-msg hook is installed at " + target)
+		}
+
+		return nil
 	},
 }
@@ -0,0 +1,225 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/rammstein4o/git-gpt/git"
+	"github.com/rammstein4o/git-gpt/utils"
+)
+
+// regenerateFunc generates a new final commit message, optionally following an extra instruction of the user.
+type regenerateFunc func(instruction string) (string, error)
+
+// confirmCommitMessage lets the user accept, edit or regenerate the commit message before committing.
+// It returns the message to commit and whether the user accepted it.
+func confirmCommitMessage(ctx context.Context, lines *lineReader, gitHelper git.Git, commitMessage string, regenerate regenerateFunc) (string, bool, error) {
+	for {
+		color.Cyan("[A]ccept (default), [e]dit, [r]egenerate, regenerate with an [i]nstruction or [q]uit?")
+		fmt.Print("> ")
+
+		answer, err := lines.readLine(ctx)
+		if err != nil {
+			return "", false, err
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "a", "accept", "":
+			return commitMessage, true, nil
+		case "e", "edit":
+			edited, err := editCommitMessage(gitHelper, commitMessage)
+			if err != nil {
+				return "", false, err
+			}
+			if edited == "" {
+				color.Red("The edited commit message is empty, keeping the previous one")
+				continue
+			}
+			commitMessage = edited
+			printCommitMessage(commitMessage)
+		case "r", "regenerate":
+			regenerated, err := regenerate("")
+			if err != nil {
+				return "", false, err
+			}
+			commitMessage = regenerated
+		case "i", "instruct", "instruction":
+			fmt.Print("Instruction: ")
+			instruction, err := lines.readLine(ctx)
+			if err != nil {
+				return "", false, err
+			}
+			instruction = strings.TrimSpace(instruction)
+			if instruction == "" {
+				continue
+			}
+
+			regenerated, err := regenerate(instruction)
+			if err != nil {
+				return "", false, err
+			}
+			commitMessage = regenerated
+		case "q", "quit", "abort":
+			return commitMessage, false, nil
+		default:
+			color.Red("Unknown choice %q", strings.TrimSpace(answer))
+		}
+	}
+}
+
+// pickCandidate lets the user choose one of the candidate commit messages.
+func pickCandidate(ctx context.Context, lines *lineReader, candidates []string) (string, error) {
+	for {
+		color.Cyan("Pick a commit message [1-%d] (default 1)", len(candidates))
+		fmt.Print("> ")
+
+		answer, err := lines.readLine(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		answer = strings.TrimSpace(answer)
+		if answer == "" {
+			return candidates[0], nil
+		}
+
+		choice, err := strconv.Atoi(answer)
+		if err != nil || choice < 1 || choice > len(candidates) {
+			color.Red("Unknown choice %q", answer)
+			continue
+		}
+
+		return candidates[choice-1], nil
+	}
+}
+
+// lineResult is a line read from the terminal, or the error that ended the input.
+type lineResult struct {
+	line string
+	err  error
+}
+
+// lineReader reads the answers of the user line by line. A line is only read when a prompt asks for one,
+// so nothing competes for the input between prompts, e.g. with the editor.
+type lineReader struct {
+	r io.Reader
+	// pending delivers the line of the read in flight, it is nil when nothing is being read.
+	pending chan lineResult
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{r: r}
+}
+
+// readLine waits for the next line of the input or for the context to be canceled, e.g. by Ctrl-C.
+// The read runs in the background, so that waiting for an answer can be canceled.
+func (lr *lineReader) readLine(ctx context.Context) (string, error) {
+	if lr.pending == nil {
+		pending := make(chan lineResult, 1)
+		lr.pending = pending
+
+		go func() {
+			line, err := readRawLine(lr.r)
+			pending <- lineResult{line: line, err: err}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		fmt.Println()
+		return "", ctx.Err()
+	case res := <-lr.pending:
+		lr.pending = nil
+		return res.line, res.err
+	}
+}
+
+// readRawLine reads up to and including the next newline. It reads byte by byte, so nothing after the line is
+// consumed and left in a buffer.
+func readRawLine(r io.Reader) (string, error) {
+	var sb strings.Builder
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			sb.WriteByte(buf[0])
+			if buf[0] == '\n' {
+				return sb.String(), nil
+			}
+		}
+		if err != nil {
+			if sb.Len() > 0 && err == io.EOF {
+				return sb.String(), nil
+			}
+			return sb.String(), err
+		}
+	}
+}
+
+// editCommitMessage opens the commit message in the editor configured for git and returns the edited text.
+// Lines starting with # are dropped, the same way git treats them.
+func editCommitMessage(gitHelper git.Git, commitMessage string) (string, error) {
+	editor, err := gitHelper.Editor()
+	if err != nil {
+		return "", err
+	}
+
+	gitDir, err := gitHelper.GitDir()
+	if err != nil {
+		return "", err
+	}
+
+	file := filepath.Join(strings.TrimSpace(gitDir), "GIT_GPT_EDITMSG")
+	content := commitMessage + "\n\n# Edit the commit message. Lines starting with '#' are ignored.\n"
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		return "", err
+	}
+	defer os.Remove(file)
+
+	if err := utils.RunEditor(editor, file); err != nil {
+		return "", err
+	}
+
+	edited, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	lines := make([]string, 0)
+	for _, line := range strings.Split(string(edited), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, strings.TrimRight(line, " \t\r"))
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
@@ -0,0 +1,82 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/rammstein4o/git-gpt/gpt"
+)
+
+// Output formats of the commands.
+const (
+	OUTPUT_TEXT = "text"
+	OUTPUT_JSON = "json"
+)
+
+// usageOutput is the token usage of a run in the JSON output.
+type usageOutput struct {
+	PromptTokens     int      `json:"prompt_tokens"`
+	CompletionTokens int      `json:"completion_tokens"`
+	TotalTokens      int      `json:"total_tokens"`
+	Requests         int      `json:"requests"`
+	CacheHits        int      `json:"cache_hits"`
+	Cost             *float64 `json:"cost_usd,omitempty"`
+}
+
+func newUsageOutput(stats *gpt.Stats) usageOutput {
+	usage := usageOutput{
+		PromptTokens:     stats.PromptTokens,
+		CompletionTokens: stats.CompletionTokens,
+		TotalTokens:      stats.TotalTokens,
+		Requests:         stats.NumRequests,
+		CacheHits:        stats.CacheHits,
+	}
+	if stats.CostKnown {
+		cost := stats.Cost
+		usage.Cost = &cost
+	}
+	return usage
+}
+
+// setOutputFormat validates the output format. The JSON output owns stdout, so progress goes to stderr.
+func setOutputFormat(output string) error {
+	switch output {
+	case OUTPUT_TEXT:
+	case OUTPUT_JSON:
+		color.Output = os.Stderr
+	default:
+		return fmt.Errorf("unknown output format %q", output)
+	}
+	return nil
+}
+
+// printJSON writes the value as indented JSON to stdout.
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
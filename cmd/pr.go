@@ -0,0 +1,156 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/rammstein4o/git-gpt/git"
+	"github.com/rammstein4o/git-gpt/gpt"
+	"github.com/rammstein4o/git-gpt/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// prCmd represents the pr command
+var prCmd = &cobra.Command{
+	Use:   "pr",
+	Short: "Describe the current branch as a pull request",
+	Long: `Write a Markdown pull request description with Summary, Changes,
+Testing notes and Risks sections from the commits and the changes of the
+current branch since it forked from the base branch.
+
+The description is rendered from the pr_description.tmpl template and printed
+to stdout, or written to --file.`,
+	Example: `  git gpt pr --base main > pr.md
+  git gpt pr --file pr.md`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := utils.CwdToGitRoot(); err != nil {
+			return err
+		}
+
+		outputFile := viper.GetString("pr.file")
+		// The description owns stdout unless it goes to a file, so progress goes to stderr.
+		if outputFile == "" {
+			color.Output = os.Stderr
+		}
+
+		language, err := outputLanguage(cmd)
+		if err != nil {
+			return err
+		}
+
+		gitHelper := newGitHelper()
+
+		base := viper.GetString("pr.base")
+		if base == "" {
+			base, err = gitHelper.DefaultBranch()
+			if err != nil {
+				return err
+			}
+		}
+
+		mergeBase, err := gitHelper.MergeBase(base)
+		if err != nil {
+			return err
+		}
+
+		revRange := mergeBase + "..HEAD"
+		commits, err := gitHelper.Log(revRange)
+		if err != nil {
+			return err
+		}
+		if len(commits) == 0 {
+			return fmt.Errorf("the current branch has no commits that are not on %s", base)
+		}
+
+		summaryCache, err := summaryCacheOrNil(gitHelper)
+		if err != nil {
+			return err
+		}
+
+		gptHelper := newGptHelper(
+			gpt.WithCache(summaryCache),
+			gpt.WithContentFingerprint(gitHelper.ContentFingerprint()),
+			gpt.WithLanguage(language),
+		)
+
+		color.Green("Summarize the changes of %d commit(s) since %s", len(commits), base)
+
+		branchHelper := newGitHelper(
+			git.WithDiffBase(mergeBase),
+			git.WithDiffTarget("HEAD"),
+		)
+
+		_, changeSummaries, err := summarizeStagedChanges(
+			cmd.Context(),
+			branchHelper,
+			gptHelper,
+			viper.GetInt("commit.concurrency"),
+		)
+		if err != nil {
+			return err
+		}
+
+		pr, err := gptHelper.DescribePullRequest(cmd.Context(), formatCommitLog(commits), changeSummaries)
+		if err != nil {
+			return err
+		}
+
+		description, err := pr.Render()
+		if err != nil {
+			return err
+		}
+		description += "\n"
+
+		printStats(gptHelper.GetStats(cmd.Context()))
+
+		if outputFile == "" {
+			fmt.Print(description)
+			return nil
+		}
+
+		color.Cyan("Write the pull request description to " + outputFile + " file")
+		return os.WriteFile(outputFile, []byte(description), 0o644)
+	},
+}
+
+// formatCommitLog lists the commit messages as a Markdown list, the bodies indented below their subjects.
+func formatCommitLog(commits []git.CommitInfo) string {
+	var sb strings.Builder
+	for _, commit := range commits {
+		subject, body, _ := strings.Cut(commit.Message, "\n")
+		sb.WriteString("- " + subject + "\n")
+		for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			sb.WriteString("  " + line + "\n")
+		}
+	}
+	return sb.String()
+}
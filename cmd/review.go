@@ -24,21 +24,121 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/fatih/color"
+	"github.com/rammstein4o/git-gpt/git"
+	"github.com/rammstein4o/git-gpt/gpt"
+	"github.com/rammstein4o/git-gpt/utils"
 	"github.com/spf13/cobra"
 )
 
+// severityColors maps every review severity to the color used to print it.
+var severityColors = map[string]*color.Color{
+	gpt.SEVERITY_CRITICAL: color.New(color.FgRed, color.Bold),
+	gpt.SEVERITY_MAJOR:    color.New(color.FgRed),
+	gpt.SEVERITY_MINOR:    color.New(color.FgYellow),
+	gpt.SEVERITY_INFO:     color.New(color.FgCyan),
+}
+
 // reviewCmd represents the review command
 var reviewCmd = &cobra.Command{
 	Use:   "review",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("review called")
+	Short: "Review staged changes",
+	Long: `Review the staged changes file by file and report findings with
+a severity, a category and a short rationale.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := utils.CwdToGitRoot(); err != nil {
+			return err
+		}
+
+		language, err := outputLanguage(cmd)
+		if err != nil {
+			return err
+		}
+
+		gitHelper := newGitHelper()
+		gptHelper := newGptHelper(
+			gpt.WithLanguage(language),
+		)
+
+		names, err := gitHelper.DiffNames()
+		if err != nil {
+			return err
+		}
+		if names == "" {
+			return fmt.Errorf("please add your staged changes using git add <files...>")
+		}
+
+		color.Green("Review the staged changes")
+
+		changes, err := stagedChanges(gitHelper)
+		if err != nil {
+			return err
+		}
+
+		totalFindings := 0
+		for _, change := range changes {
+			// There is nothing to review in removed files, binaries or exact moves.
+			if change.Kind == git.OPERATION_DEL || utils.IsBinaryFile(change.Path) {
+				continue
+			}
+			if change.IsMove() && change.Score >= 100 {
+				continue
+			}
+
+			var diff string
+			if change.IsMove() {
+				diff, err = gitHelper.DiffMove(change.OldPath, change.Path)
+			} else {
+				diff, err = gitHelper.DiffFile(change.Path)
+			}
+			if err != nil {
+				return err
+			}
+			if strings.TrimSpace(diff) == "" {
+				continue
+			}
+
+			findings, err := gptHelper.ReviewDiff(cmd.Context(), change.Path, diff)
+			if err != nil {
+				return err
+			}
+
+			printReviewFindings(change.Path, findings)
+			totalFindings += len(findings)
+		}
+
+		color.Yellow("==================================================")
+		color.Yellow(fmt.Sprintf("%d finding(s) in total", totalFindings))
+
+		printStats(gptHelper.GetStats(cmd.Context()))
+
+		return nil
 	},
 }
+
+func printReviewFindings(fileName string, findings []gpt.ReviewFinding) {
+	color.Yellow("================" + fileName + "================")
+
+	if len(findings) == 0 {
+		color.Green("No findings")
+		return
+	}
+
+	for _, finding := range findings {
+		c, ok := severityColors[finding.Severity]
+		if !ok {
+			c = severityColors[gpt.SEVERITY_INFO]
+		}
+
+		c.Printf("[%s] %s: %s\n", strings.ToUpper(finding.Severity), finding.Category, finding.Summary)
+		if finding.Line != "" {
+			fmt.Printf("    at: %s\n", strings.TrimSpace(finding.Line))
+		}
+		if finding.Rationale != "" {
+			fmt.Printf("    %s\n", finding.Rationale)
+		}
+	}
+}
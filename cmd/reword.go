@@ -0,0 +1,259 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+	"github.com/rammstein4o/git-gpt/git"
+	"github.com/rammstein4o/git-gpt/gpt"
+	"github.com/rammstein4o/git-gpt/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// rewordSubjectWidth is the number of characters of a subject shown in the before/after table.
+const rewordSubjectWidth = 60
+
+// rewordCmd represents the reword command
+var rewordCmd = &cobra.Command{
+	Use:   "reword <revision range>",
+	Short: "Suggest better messages for existing commits",
+	Long: `Generate a message for every commit of the revision range from its own
+changes and show them next to the current messages.
+
+With --apply the commits are recreated with the new messages and the current
+branch is moved to them. Trees, authors and dates are kept, so the replay never
+conflicts. Ranges with merges or commits that were already pushed are refused
+unless --force is given, merges always keep their messages.`,
+	Example: `  git gpt reword HEAD~5..HEAD
+  git gpt reword main..feature --apply`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := utils.CwdToGitRoot(); err != nil {
+			return err
+		}
+
+		revRange := args[0]
+
+		apply, err := cmd.Flags().GetBool("apply")
+		if err != nil {
+			return err
+		}
+		force, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			return err
+		}
+
+		switch style := viper.GetString("commit.style"); style {
+		case gpt.COMMIT_STYLE_DEFAULT, gpt.COMMIT_STYLE_CONVENTIONAL:
+		default:
+			return fmt.Errorf("unknown commit style %q", style)
+		}
+
+		language, err := outputLanguage(cmd)
+		if err != nil {
+			return err
+		}
+
+		gitHelper := newGitHelper()
+
+		commits, err := gitHelper.Log(revRange)
+		if err != nil {
+			return err
+		}
+		if len(commits) == 0 {
+			return fmt.Errorf("there are no commits in %s", revRange)
+		}
+
+		// The messages above may be redacted, the comparison with the suggestions needs them as they are.
+		originals, err := git.New().Log(revRange)
+		if err != nil {
+			return err
+		}
+		originalMessages := make(map[string]string, len(originals))
+		for _, commit := range originals {
+			originalMessages[commit.Hash] = commit.Message
+		}
+
+		// Check before anything is generated, the suggestions are of no use if they cannot be applied.
+		if apply && !force {
+			if err := checkRewordable(gitHelper, revRange, commits); err != nil {
+				return err
+			}
+		}
+
+		summaryCache, err := summaryCacheOrNil(gitHelper)
+		if err != nil {
+			return err
+		}
+
+		gptHelper := newGptHelper(
+			gpt.WithCache(summaryCache),
+			gpt.WithContentFingerprint(gitHelper.ContentFingerprint()),
+			gpt.WithLanguage(language),
+		)
+
+		messages := make(map[string]string, len(commits))
+		for _, commit := range commits {
+			if commit.IsMerge() {
+				color.Cyan("Keep the message of merge %s", commit.ShortHash())
+				continue
+			}
+
+			color.Green("Summarize the changes of %s %s", commit.ShortHash(), commit.Subject())
+
+			message, err := suggestCommitMessage(cmd.Context(), gptHelper, commit)
+			if err != nil {
+				return fmt.Errorf("commit %s: %w", commit.ShortHash(), err)
+			}
+			// A commit that would keep its message is not recreated for nothing. The model only saw the redacted
+			// message, reproducing that keeps the original as well.
+			message = strings.TrimSpace(message)
+			if message != "" && message != commit.Message && message != originalMessages[commit.Hash] {
+				messages[commit.Hash] = message
+			}
+		}
+
+		printRewordTable(commits, messages)
+		printStats(gptHelper.GetStats(cmd.Context()))
+
+		if !apply {
+			color.Cyan("Run again with --apply to rewrite the commits")
+			return nil
+		}
+
+		if len(messages) == 0 {
+			color.Cyan("Nothing to rewrite")
+			return nil
+		}
+
+		newHead, err := gitHelper.Reword(revRange, messages)
+		if err != nil {
+			return err
+		}
+		color.Cyan("Reworded %d commit(s), HEAD is now at %s", len(messages), git.ShortHash(newHead))
+
+		return nil
+	},
+}
+
+// checkRewordable refuses ranges with merges or with commits that are reachable from a remote-tracking branch.
+func checkRewordable(gitHelper git.Git, revRange string, commits []git.CommitInfo) error {
+	for _, commit := range commits {
+		if commit.IsMerge() {
+			return fmt.Errorf("%s contains the merge %s, use --force to rewrite it anyway", revRange, commit.ShortHash())
+		}
+	}
+
+	pushed, err := gitHelper.PushedCommits(revRange)
+	if err != nil {
+		return err
+	}
+	if len(pushed) > 0 {
+		return fmt.Errorf("%d commit(s) of %s were already pushed, e.g. %s, use --force to rewrite them anyway", len(pushed), revRange, git.ShortHash(pushed[0]))
+	}
+
+	return nil
+}
+
+// suggestCommitMessage generates a new message for the commit from its own changes through the same pipeline as
+// commit. It returns an empty message for a commit without changes to describe.
+func suggestCommitMessage(ctx context.Context, gptHelper gpt.Gpt, commit git.CommitInfo) (string, error) {
+	base := git.EmptyTree
+	if len(commit.Parents) > 0 {
+		base = commit.Parents[0]
+	}
+
+	gitHelper := newGitHelper(
+		git.WithDiffBase(base),
+		git.WithDiffTarget(commit.Hash),
+	)
+
+	names, err := gitHelper.DiffNames()
+	if err != nil {
+		return "", err
+	}
+	if names == "" {
+		return "", nil
+	}
+
+	changes, changeSummaries, err := summarizeStagedChanges(
+		ctx,
+		gitHelper,
+		gptHelper,
+		viper.GetInt("commit.concurrency"),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	summary, err := gptHelper.SummarizeChanges(ctx, changeSummaries)
+	if err != nil {
+		return "", err
+	}
+
+	hints, err := commitHints(gitHelper, changes)
+	if err != nil {
+		return "", err
+	}
+	hints.PreviousMessage = commit.Message
+
+	candidates, err := finalizeCandidates(ctx, gptHelper, summary, hints, 1)
+	if err != nil {
+		return "", err
+	}
+
+	return candidates[0], nil
+}
+
+// printRewordTable shows the current and the suggested subject of every commit.
+func printRewordTable(commits []git.CommitInfo, messages map[string]string) {
+	w := tabwriter.NewWriter(color.Output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COMMIT\tBEFORE\tAFTER")
+
+	for _, commit := range commits {
+		after := "(unchanged)"
+		if message, ok := messages[commit.Hash]; ok {
+			after = truncateSubject(message)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", commit.ShortHash(), truncateSubject(commit.Message), after)
+	}
+
+	w.Flush()
+}
+
+// truncateSubject returns the first line of the message, shortened to fit the table.
+func truncateSubject(message string) string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	if utf8.RuneCountInString(subject) <= rewordSubjectWidth {
+		return subject
+	}
+
+	return string([]rune(subject)[:rewordSubjectWidth-1]) + "…"
+}
@@ -23,11 +23,20 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/rammstein4o/git-gpt/utils"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
+// cancelTimeout releases the overall timeout of the run, if one was set.
+var cancelTimeout context.CancelFunc = func() {}
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "git-gpt",
@@ -41,13 +50,39 @@ to quickly create a Cobra application.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// The templates commands report broken overrides themselves.
+		if err := utils.LoadTemplateOverrides(templateDirs()...); err != nil && cmd.Parent() != templatesCmd {
+			return err
+		}
+
+		if timeout := viper.GetDuration("request.total_timeout"); timeout > 0 {
+			var ctx context.Context
+			ctx, cancelTimeout = context.WithTimeout(cmd.Context(), timeout)
+			cmd.SetContext(ctx)
+		}
+
+		return nil
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	err := rootCmd.Execute()
+	// Ctrl-C cancels the requests in flight, a second one terminates right away.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	cancelTimeout()
+	stop()
 	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			os.Exit(130)
+		}
 		os.Exit(1)
 	}
 }
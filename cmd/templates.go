@@ -0,0 +1,140 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/rammstein4o/git-gpt/utils"
+	"github.com/spf13/cobra"
+)
+
+// repoTemplatesDir is where a repository keeps its own templates, relative to its root.
+var repoTemplatesDir = filepath.Join(".git-gpt", "templates")
+
+// templateDirs returns the directories overriding the built-in templates, from the lowest to the highest priority:
+// $XDG_CONFIG_HOME/git-gpt/templates first and the templates of the current repository last.
+func templateDirs() []string {
+	dirs := make([]string, 0, 2)
+
+	if configDir, err := utils.ConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(configDir, "templates"))
+	}
+	if root, err := utils.GitRoot(); err == nil {
+		dirs = append(dirs, filepath.Join(root, repoTemplatesDir))
+	}
+
+	return dirs
+}
+
+// templatesCmd represents the templates command
+var templatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "Inspect and customize the prompt templates",
+	Long: `Inspect and customize the prompt templates.
+
+Templates are looked up in the .git-gpt/templates directory of the repository first,
+then in $XDG_CONFIG_HOME/git-gpt/templates and finally in the built-in defaults.
+A file overrides the built-in template with the same name.`,
+}
+
+// templatesListCmd represents the templates list command
+var templatesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the templates and the source each one is loaded from",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, info := range utils.ListTemplates() {
+			source := info.Source
+			if source != utils.TEMPLATE_SOURCE_EMBEDDED {
+				source = color.CyanString(source)
+			}
+			if info.Err != nil {
+				source += color.RedString(" (broken override: %v)", info.Err)
+			}
+			fmt.Printf("%-32s %s\n", info.Name, source)
+		}
+		return nil
+	},
+}
+
+// templatesExportCmd represents the templates export command
+var templatesExportCmd = &cobra.Command{
+	Use:   "export [dir]",
+	Short: "Copy the built-in templates into a directory, by default .git-gpt/templates of the repository",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := ""
+		if len(args) > 0 {
+			dir = args[0]
+		} else {
+			root, err := utils.GitRoot()
+			if err != nil {
+				return err
+			}
+			dir = filepath.Join(root, repoTemplatesDir)
+		}
+
+		force, _ := cmd.Flags().GetBool("force")
+
+		written, err := utils.ExportTemplates(dir, force)
+		for _, file := range written {
+			fmt.Println(file)
+		}
+		if err != nil {
+			return err
+		}
+
+		color.Green("Exported %d templates to %s", len(written), dir)
+		return nil
+	},
+}
+
+// templatesCheckCmd represents the templates check command
+var templatesCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Render every template with sample data to find mistakes",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		failed := 0
+		for _, info := range utils.ListTemplates() {
+			err := info.Err
+			if err == nil {
+				err = utils.CheckTemplate(info.Name)
+			}
+			if err != nil {
+				failed++
+				color.Red("%-32s %v", info.Name, err)
+				continue
+			}
+			color.Green("%-32s ok", info.Name)
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d templates failed the check", failed)
+		}
+		return nil
+	},
+}
@@ -25,6 +25,8 @@ package git
 type config struct {
 	diffUnified int
 	excludeList []string
+	diffBase    string
+	diffTarget  string
 }
 
 type Option func(*config)
@@ -46,3 +48,17 @@ func WithExcludeList(val []string) Option {
 		c.excludeList = val
 	}
 }
+
+// WithDiffBase compares the index against the given revision instead of HEAD, e.g. HEAD^ to amend the last commit.
+func WithDiffBase(rev string) Option {
+	return func(c *config) {
+		c.diffBase = rev
+	}
+}
+
+// WithDiffTarget compares the base against the given commit instead of the index, e.g. to describe an existing commit.
+func WithDiffTarget(rev string) Option {
+	return func(c *config) {
+		c.diffTarget = rev
+	}
+}
@@ -23,22 +23,13 @@
 package git
 
 import (
-	"errors"
 	"fmt"
-	"os"
 	"os/exec"
-	"path"
 	"strings"
-
-	"github.com/rammstein4o/git-gpt/utils"
 )
 
-const hookFileName = "prepare-commit-msg"
-
-var hookTemplate = `#!/bin/sh
-
-git gpt commit --file $1 --preview
-`
+// EmptyTree is the object name of the empty tree, the base of a root commit.
+const EmptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
 
 var excludeFromDiff = []string{
 	"package-lock.json",
@@ -49,14 +40,29 @@ var excludeFromDiff = []string{
 }
 
 type Git interface {
-	Status() (string, error)
+	StagedChanges() ([]StagedChange, error)
+	NumStat() ([]FileStat, error)
 	Commit(val string) (string, error)
+	Amend(val string) (string, error)
+	AmendBase() (string, error)
+	HeadMessage() (string, error)
+	Log(revRange string) ([]CommitInfo, error)
+	MergeBase(base string) (string, error)
+	DefaultBranch() (string, error)
+	PushedCommits(revRange string) ([]string, error)
+	Reword(revRange string, messages map[string]string) (string, error)
 	GitDir() (string, error)
+	Editor() (string, error)
 	DiffNames() (string, error)
 	DiffFile(file string) (string, error)
+	DiffMove(oldFile, newFile string) (string, error)
+	ShowStagedFile(file string) (string, error)
 	ShowDeletedFile(file string) (string, error)
-	InstallHook() error
-	UninstallHook() error
+	HookPath() (string, error)
+	HookStatus() (HookState, error)
+	InstallHook(force bool) error
+	UninstallHook(force bool) error
+	ContentFingerprint() string
 }
 
 // Ensure, that gitcmd does implement Git.
@@ -66,35 +72,103 @@ type gitcmd struct {
 	cfg *config
 }
 
+// excludeFiles returns the pathspecs leaving out the default and the user-defined excludes.
 func (gc *gitcmd) excludeFiles() []string {
+	excludedFiles := excludePathspecs(excludeFromDiff)
+	return append(excludedFiles, excludePathspecs(gc.cfg.excludeList)...)
+}
+
+// excludePathspecs turns the glob patterns into pathspecs leaving out the matching files.
+func excludePathspecs(patterns []string) []string {
 	var excludedFiles []string
-	for _, f := range gc.cfg.excludeList {
+	for _, f := range patterns {
 		excludedFiles = append(excludedFiles, ":(exclude)"+f)
 	}
 	return excludedFiles
 }
 
-func (gc *gitcmd) hookPath() (string, error) {
+// base returns the revision the index is compared against.
+func (gc *gitcmd) base() string {
+	if gc.cfg.diffBase != "" {
+		return gc.cfg.diffBase
+	}
+	return "HEAD"
+}
+
+// stagedArgs returns the arguments comparing the index, or the target commit if one is set, against the base revision.
+func (gc *gitcmd) stagedArgs() []string {
+	if gc.cfg.diffTarget != "" {
+		return []string{gc.base(), gc.cfg.diffTarget}
+	}
+
+	args := []string{"--cached"}
+	if gc.cfg.diffBase != "" {
+		args = append(args, gc.cfg.diffBase)
+	}
+	return args
+}
+
+// StagedChanges lists the staged changes including renames, copies and type changes.
+func (gc *gitcmd) StagedChanges() ([]StagedChange, error) {
+	args := []string{"diff"}
+	args = append(args, gc.stagedArgs()...)
+	args = append(args,
+		"--raw",
+		"--no-abbrev",
+		"-z",
+		"-M",
+		"-C",
+		"--",
+	)
+
+	excludedFiles := gc.excludeFiles()
+	args = append(args, excludedFiles...)
+
 	out, err := exec.Command(
 		"git",
-		"rev-parse",
-		"--git-path",
-		"hooks",
+		args...,
 	).Output()
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return string(out), nil
+	return ParseStagedChanges(string(out))
 }
 
-func (gc *gitcmd) Status() (string, error) {
+// NumStat counts the added and deleted lines of every staged file. Only the user-defined excludes apply, the lock
+// files and snapshots left out by default are counted, they are what tells a dependency bump apart.
+func (gc *gitcmd) NumStat() ([]FileStat, error) {
+	args := []string{"diff"}
+	args = append(args, gc.stagedArgs()...)
+	args = append(args,
+		"--numstat",
+		"-z",
+		"-M",
+		"-C",
+		"--",
+	)
+	args = append(args, excludePathspecs(gc.cfg.excludeList)...)
+
 	out, err := exec.Command(
 		"git",
-		"status",
-		"--short",
-		"--no-renames",
+		args...,
+	).Output()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseNumStat(string(out))
+}
+
+func (gc *gitcmd) Commit(val string) (string, error) {
+	out, err := exec.Command(
+		"git",
+		"commit",
+		"--no-verify",
+		"--signoff",
+		fmt.Sprintf("--message=%s", val),
 	).Output()
 
 	if err != nil {
@@ -104,10 +178,12 @@ func (gc *gitcmd) Status() (string, error) {
 	return string(out), nil
 }
 
-func (gc *gitcmd) Commit(val string) (string, error) {
+// Amend replaces the last commit with the index and the given message.
+func (gc *gitcmd) Amend(val string) (string, error) {
 	out, err := exec.Command(
 		"git",
 		"commit",
+		"--amend",
 		"--no-verify",
 		"--signoff",
 		fmt.Sprintf("--message=%s", val),
@@ -120,6 +196,84 @@ func (gc *gitcmd) Commit(val string) (string, error) {
 	return string(out), nil
 }
 
+// AmendBase returns the revision the last commit is based on, or the empty tree for a root commit.
+func (gc *gitcmd) AmendBase() (string, error) {
+	if err := exec.Command("git", "rev-parse", "--verify", "--quiet", "HEAD").Run(); err != nil {
+		return "", fmt.Errorf("there is no commit to amend yet")
+	}
+
+	out, err := exec.Command(
+		"git",
+		"rev-parse",
+		"--verify",
+		"--quiet",
+		"HEAD^",
+	).Output()
+
+	if err != nil {
+		return EmptyTree, nil
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// HeadMessage returns the message of the last commit.
+func (gc *gitcmd) HeadMessage() (string, error) {
+	out, err := exec.Command(
+		"git",
+		"log",
+		"-1",
+		"--format=%B",
+		"HEAD",
+	).Output()
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// MergeBase returns the best common ancestor of the given branch and HEAD.
+func (gc *gitcmd) MergeBase(base string) (string, error) {
+	out, err := exec.Command(
+		"git",
+		"merge-base",
+		"--end-of-options",
+		base,
+		"HEAD",
+	).Output()
+
+	if err != nil {
+		return "", fmt.Errorf("no common ancestor of %s and HEAD", base)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// DefaultBranch guesses the branch pull requests are opened against: the default branch of origin, main or master.
+func (gc *gitcmd) DefaultBranch() (string, error) {
+	out, err := exec.Command(
+		"git",
+		"symbolic-ref",
+		"--quiet",
+		"--short",
+		"refs/remotes/origin/HEAD",
+	).Output()
+
+	if err == nil {
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	for _, branch := range []string{"main", "master"} {
+		if _, err := revParse("refs/heads/" + branch); err == nil {
+			return branch, nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot tell the base branch, please pass it with --base")
+}
+
 // GitDir to show the (by default, absolute) path of the git directory of the working tree.
 func (gc *gitcmd) GitDir() (string, error) {
 	out, err := exec.Command(
@@ -135,13 +289,26 @@ func (gc *gitcmd) GitDir() (string, error) {
 	return string(out), nil
 }
 
-func (gc *gitcmd) DiffNames() (string, error) {
-	args := []string{
-		"diff",
-		"--name-only",
-		"--staged",
+// Editor returns the editor git uses for commit messages, honouring GIT_EDITOR, core.editor, VISUAL and EDITOR.
+func (gc *gitcmd) Editor() (string, error) {
+	out, err := exec.Command(
+		"git",
+		"var",
+		"GIT_EDITOR",
+	).Output()
+
+	if err != nil {
+		return "", err
 	}
 
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (gc *gitcmd) DiffNames() (string, error) {
+	args := []string{"diff"}
+	args = append(args, gc.stagedArgs()...)
+	args = append(args, "--name-only")
+
 	excludedFiles := gc.excludeFiles()
 	args = append(args, excludedFiles...)
 
@@ -158,16 +325,17 @@ func (gc *gitcmd) DiffNames() (string, error) {
 }
 
 func (gc *gitcmd) DiffFile(file string) (string, error) {
-	args := []string{
-		"diff",
+	args := []string{"diff"}
+	args = append(args, gc.stagedArgs()...)
+	args = append(args,
 		"--ignore-all-space",
 		"--no-color",
 		"--diff-algorithm=minimal",
 		fmt.Sprintf("--unified=%d", gc.cfg.diffUnified),
-		"--staged",
-	}
+	)
 
 	excludedFiles := gc.excludeFiles()
+	args = append(args, "--")
 	args = append(args, excludedFiles...)
 	args = append(args, file)
 
@@ -183,11 +351,32 @@ func (gc *gitcmd) DiffFile(file string) (string, error) {
 	return string(out), nil
 }
 
-func (gc *gitcmd) ShowDeletedFile(file string) (string, error) {
+// ContentFingerprint describes the settings that shape the diffs and file contents returned, so that answers
+// derived from them are only reused while the settings stay the same.
+func (gc *gitcmd) ContentFingerprint() string {
+	return fmt.Sprintf("unified=%d", gc.cfg.diffUnified)
+}
+
+// DiffMove shows the staged diff of a renamed or copied file against its source.
+func (gc *gitcmd) DiffMove(oldFile, newFile string) (string, error) {
+	args := []string{"diff"}
+	args = append(args, gc.stagedArgs()...)
+	args = append(args,
+		"--ignore-all-space",
+		"--no-color",
+		"--diff-algorithm=minimal",
+		fmt.Sprintf("--unified=%d", gc.cfg.diffUnified),
+		"-M",
+		"-C",
+		"--find-copies-harder",
+		"--",
+		oldFile,
+		newFile,
+	)
+
 	out, err := exec.Command(
 		"git",
-		"show",
-		fmt.Sprintf("HEAD^:%s", file),
+		args...,
 	).Output()
 
 	if err != nil {
@@ -197,36 +386,34 @@ func (gc *gitcmd) ShowDeletedFile(file string) (string, error) {
 	return string(out), nil
 }
 
-func (gc *gitcmd) InstallHook() error {
-	hookPath, err := gc.hookPath()
-	if err != nil {
-		return err
-	}
-
-	target := path.Join(strings.TrimSpace(hookPath), hookFileName)
-	if utils.IsFile(target) {
-		return errors.New("hook file prepare-commit-msg exist")
-	}
+// ShowStagedFile returns the content of the file as it is staged in the index, or as it is in the target commit.
+func (gc *gitcmd) ShowStagedFile(file string) (string, error) {
+	out, err := exec.Command(
+		"git",
+		"show",
+		fmt.Sprintf("%s:%s", gc.cfg.diffTarget, file),
+	).Output()
 
-	content, err := utils.GetTemplateByBytes(hookTemplate, nil)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return os.WriteFile(target, content, 0o755)
+	return string(out), nil
 }
 
-func (gc *gitcmd) UninstallHook() error {
-	hookPath, err := gc.hookPath()
+// ShowDeletedFile returns the content of a file removed from the index as it was in the base revision.
+func (gc *gitcmd) ShowDeletedFile(file string) (string, error) {
+	out, err := exec.Command(
+		"git",
+		"show",
+		fmt.Sprintf("%s:%s", gc.base(), file),
+	).Output()
+
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	target := path.Join(strings.TrimSpace(hookPath), hookFileName)
-	if !utils.IsFile(target) {
-		return errors.New("hook file prepare-commit-msg does not exist")
-	}
-	return os.Remove(target)
+	return string(out), nil
 }
 
 func New(opts ...Option) Git {
@@ -238,9 +425,6 @@ func New(opts ...Option) Git {
 		fn(cfg)
 	}
 
-	// Append the user-defined excludeList to the default excludeFromDiff
-	cfg.excludeList = append(excludeFromDiff, cfg.excludeList...)
-
 	return &gitcmd{
 		cfg: cfg,
 	}
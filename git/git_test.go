@@ -0,0 +1,64 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package git
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestNumStatCountsLockFiles(t *testing.T) {
+	testRepo(t)
+
+	commitFile(t, "go.mod", "module a\n", "first")
+	for name, content := range map[string]string{"go.mod": "module a\n\ngo 1.21\n", "go.sum": "a v1.0.0 h1:x\n", "big.min.js": "x\n"} {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runGit(t, "add", "-A")
+
+	gc := New(WithExcludeList([]string{"*.min.js"}))
+
+	changes, err := gc.StagedChanges()
+	if err != nil {
+		t.Fatalf("StagedChanges() error = %v", err)
+	}
+	if len(changes) != 1 || changes[0].Path != "go.mod" {
+		t.Errorf("StagedChanges() = %+v, want go.mod only", changes)
+	}
+
+	// The lock file is counted, the file excluded by the user is not.
+	stats, err := gc.NumStat()
+	if err != nil {
+		t.Fatalf("NumStat() error = %v", err)
+	}
+	paths := make([]string, 0, len(stats))
+	for _, stat := range stats {
+		paths = append(paths, stat.Path)
+	}
+	if want := []string{"go.mod", "go.sum"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("NumStat() paths = %q, want %q", paths, want)
+	}
+}
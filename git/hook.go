@@ -0,0 +1,169 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package git
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/rammstein4o/git-gpt/utils"
+)
+
+//go:embed templates/prepare-commit-msg.tmpl
+var hookTemplateSource string
+
+// hookTemplate renders the hook script. It is kept apart from the prompt templates,
+// so it is neither listed nor exported and a template directory cannot replace the executed script.
+var hookTemplate = template.Must(template.New(hookFileName).Parse(hookTemplateSource))
+
+const (
+	hookFileName = "prepare-commit-msg"
+	// hookMarker is written into the installed script so that it can be told apart from hooks installed by other tools.
+	hookMarker = "git-gpt prepare-commit-msg hook"
+)
+
+type HookState int
+
+const (
+	HOOK_NOT_INSTALLED HookState = iota
+	HOOK_INSTALLED
+	HOOK_FOREIGN
+)
+
+func (s HookState) String() string {
+	switch s {
+	case HOOK_INSTALLED:
+		return "installed"
+	case HOOK_FOREIGN:
+		return "foreign"
+	default:
+		return "not installed"
+	}
+}
+
+// HookPath returns the absolute path of the prepare-commit-msg hook, honouring core.hooksPath.
+func (gc *gitcmd) HookPath() (string, error) {
+	out, err := exec.Command(
+		"git",
+		"rev-parse",
+		"--git-path",
+		"hooks",
+	).Output()
+
+	if err != nil {
+		return "", err
+	}
+
+	hooksDir, err := filepath.Abs(strings.TrimSpace(string(out)))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(hooksDir, hookFileName), nil
+}
+
+// HookStatus reports whether our hook, a hook installed by someone else or no hook at all is present.
+func (gc *gitcmd) HookStatus() (HookState, error) {
+	target, err := gc.HookPath()
+	if err != nil {
+		return HOOK_NOT_INSTALLED, err
+	}
+
+	if !utils.IsFile(target) {
+		return HOOK_NOT_INSTALLED, nil
+	}
+
+	content, err := os.ReadFile(target)
+	if err != nil {
+		return HOOK_NOT_INSTALLED, err
+	}
+
+	if bytes.Contains(content, []byte(hookMarker)) {
+		return HOOK_INSTALLED, nil
+	}
+
+	return HOOK_FOREIGN, nil
+}
+
+// InstallHook writes the prepare-commit-msg hook. An existing foreign hook is only replaced when force is set.
+func (gc *gitcmd) InstallHook(force bool) error {
+	state, err := gc.HookStatus()
+	if err != nil {
+		return err
+	}
+
+	target, err := gc.HookPath()
+	if err != nil {
+		return err
+	}
+
+	if state == HOOK_FOREIGN && !force {
+		return fmt.Errorf("a foreign %s hook already exists at %s, use --force to replace it", hookFileName, target)
+	}
+
+	var content bytes.Buffer
+	if err := hookTemplate.Execute(&content, map[string]interface{}{"marker": hookMarker}); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(target, append(bytes.TrimSpace(content.Bytes()), '\n'), 0o755); err != nil {
+		return err
+	}
+
+	// WriteFile keeps the mode of a replaced file, so make sure the hook is executable.
+	return os.Chmod(target, 0o755)
+}
+
+// UninstallHook removes our prepare-commit-msg hook. A foreign hook is only removed when force is set.
+func (gc *gitcmd) UninstallHook(force bool) error {
+	state, err := gc.HookStatus()
+	if err != nil {
+		return err
+	}
+
+	target, err := gc.HookPath()
+	if err != nil {
+		return err
+	}
+
+	switch state {
+	case HOOK_NOT_INSTALLED:
+		return fmt.Errorf("no %s hook found at %s", hookFileName, target)
+	case HOOK_FOREIGN:
+		if !force {
+			return fmt.Errorf("the %s hook at %s was not installed by git-gpt, use --force to remove it", hookFileName, target)
+		}
+	}
+
+	return os.Remove(target)
+}
@@ -22,36 +22,152 @@
 
 package git
 
-import "strings"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 type GitOperation string
 
 const (
-	OPERATION_ADD GitOperation = "A"
-	OPERATION_DEL GitOperation = "D"
-	OPERATION_MOD GitOperation = "M"
+	OPERATION_ADD      GitOperation = "A"
+	OPERATION_DEL      GitOperation = "D"
+	OPERATION_MOD      GitOperation = "M"
+	OPERATION_RENAME   GitOperation = "R"
+	OPERATION_COPY     GitOperation = "C"
+	OPERATION_TYPE     GitOperation = "T"
+	OPERATION_UNMERGED GitOperation = "U"
 )
 
-func ParseGitStatus(status string) (added, removed, modified []string) {
-	lines := strings.Split(status, "\n")
+// StagedChange describes a single entry of the staged changes.
+type StagedChange struct {
+	Kind GitOperation
+	// OldPath is the source of a rename or copy, it is empty for every other kind.
+	OldPath string
+	Path    string
+	// Score is the similarity index of a rename or copy in percent.
+	Score int
+	// OldBlob and NewBlob are the object names before and after the change, all zeros when there is no such side.
+	OldBlob string
+	NewBlob string
+}
+
+// IsMove reports whether the change is a rename or a copy.
+func (sc StagedChange) IsMove() bool {
+	return sc.Kind == OPERATION_RENAME || sc.Kind == OPERATION_COPY
+}
+
+// ParseStagedChanges parses the output of `git diff --cached --raw --no-abbrev -z`.
+// Every entry is a ":<old mode> <new mode> <old blob> <new blob> <status>" field followed by one path,
+// or by two paths for renames and copies, all NUL terminated.
+func ParseStagedChanges(out string) ([]StagedChange, error) {
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	if len(fields) == 1 && fields[0] == "" {
+		return nil, nil
+	}
+
+	changes := make([]StagedChange, 0)
+
+	for i := 0; i < len(fields); {
+		meta := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if !strings.HasPrefix(fields[i], ":") || len(meta) != 5 {
+			return nil, fmt.Errorf("unexpected raw diff entry %q", fields[i])
+		}
+
+		status := meta[4]
+		change := StagedChange{
+			Kind:    GitOperation(status[:1]),
+			OldBlob: meta[2],
+			NewBlob: meta[3],
+		}
+
+		if len(status) > 1 {
+			score, err := strconv.Atoi(status[1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid similarity score in status %q", status)
+			}
+			change.Score = score
+		}
+
+		numPaths := 1
+		if change.IsMove() {
+			numPaths = 2
+		}
+
+		if i+numPaths >= len(fields) {
+			return nil, fmt.Errorf("missing path for status %q", status)
+		}
 
-	for _, line := range lines {
-		if len(line) < 4 {
-			continue
+		if numPaths == 2 {
+			change.OldPath = fields[i+1]
+			change.Path = fields[i+2]
+		} else {
+			change.Path = fields[i+1]
 		}
 
-		status := GitOperation(strings.TrimSpace(line[:2]))
-		file := strings.TrimSpace(line[3:])
+		changes = append(changes, change)
+		i += numPaths + 1
+	}
+
+	return changes, nil
+}
+
+// FileStat is the number of added and deleted lines of a changed file, as reported by `git diff --numstat`.
+type FileStat struct {
+	// OldPath is the source of a rename or copy, it is empty for every other change.
+	OldPath string
+	Path    string
+	Added   int
+	Deleted int
+	// Binary is set for files without line counts.
+	Binary bool
+}
 
-		switch status {
-		case OPERATION_ADD:
-			added = append(added, file)
-		case OPERATION_DEL:
-			removed = append(removed, file)
-		case OPERATION_MOD:
-			modified = append(modified, file)
+// ParseNumStat parses the output of `git diff --numstat -z`. Every entry is "<added>\t<deleted>\t<path>" NUL terminated,
+// renames and copies leave the path empty and follow it with the old and the new path, each NUL terminated.
+func ParseNumStat(out string) ([]FileStat, error) {
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	if len(fields) == 1 && fields[0] == "" {
+		return nil, nil
+	}
+
+	stats := make([]FileStat, 0)
+
+	for i := 0; i < len(fields); {
+		parts := strings.SplitN(fields[i], "\t", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("unexpected numstat entry %q", fields[i])
+		}
+
+		stat := FileStat{Path: parts[2]}
+		if parts[0] == "-" && parts[1] == "-" {
+			stat.Binary = true
+		} else {
+			added, err := strconv.Atoi(parts[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid number of added lines in %q", fields[i])
+			}
+			deleted, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid number of deleted lines in %q", fields[i])
+			}
+			stat.Added = added
+			stat.Deleted = deleted
 		}
+
+		i++
+		if stat.Path == "" {
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("missing paths of numstat entry %q", parts[0]+"\t"+parts[1])
+			}
+			stat.OldPath = fields[i]
+			stat.Path = fields[i+1]
+			i += 2
+		}
+
+		stats = append(stats, stat)
 	}
 
-	return added, removed, modified
+	return stats, nil
 }
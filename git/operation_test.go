@@ -0,0 +1,265 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package git
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	zeroBlob = "0000000000000000000000000000000000000000"
+	blobA    = "8cc35a3d55c810ba1f998f398e475feb0e5f6b8a"
+	blobB    = "bec81d2b1ca4cdf376a684e3483bcfd139659116"
+)
+
+// raw builds one entry of `git diff --raw --no-abbrev -z`, the paths follow the status NUL separated.
+func raw(oldMode, newMode, oldBlob, newBlob, status string, paths ...string) string {
+	return ":" + oldMode + " " + newMode + " " + oldBlob + " " + newBlob + " " + status + "\x00" + strings.Join(paths, "\x00") + "\x00"
+}
+
+func TestParseStagedChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    []StagedChange
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			out:  "",
+		},
+		{
+			name: "added and modified",
+			out:  raw("000000", "100644", zeroBlob, blobA, "A", "new.txt") + raw("100644", "100644", blobA, blobB, "M", "main.go"),
+			want: []StagedChange{
+				{Kind: OPERATION_ADD, Path: "new.txt", OldBlob: zeroBlob, NewBlob: blobA},
+				{Kind: OPERATION_MOD, Path: "main.go", OldBlob: blobA, NewBlob: blobB},
+			},
+		},
+		{
+			name: "rename and copy with scores",
+			out:  raw("100644", "100644", blobA, blobA, "R100", "moved.txt", "renamed.txt") + raw("100644", "100644", blobA, blobB, "C075", "orig.txt", "copy.txt"),
+			want: []StagedChange{
+				{Kind: OPERATION_RENAME, OldPath: "moved.txt", Path: "renamed.txt", Score: 100, OldBlob: blobA, NewBlob: blobA},
+				{Kind: OPERATION_COPY, OldPath: "orig.txt", Path: "copy.txt", Score: 75, OldBlob: blobA, NewBlob: blobB},
+			},
+		},
+		{
+			name: "type change",
+			out:  raw("100644", "120000", blobA, blobB, "T", "link"),
+			want: []StagedChange{
+				{Kind: OPERATION_TYPE, Path: "link", OldBlob: blobA, NewBlob: blobB},
+			},
+		},
+		{
+			name: "unmerged",
+			out:  raw("100644", "000000", blobA, zeroBlob, "U", "conflict.txt") + raw("000000", "100644", zeroBlob, blobB, "A", "s.txt"),
+			want: []StagedChange{
+				{Kind: OPERATION_UNMERGED, Path: "conflict.txt", OldBlob: blobA, NewBlob: zeroBlob},
+				{Kind: OPERATION_ADD, Path: "s.txt", OldBlob: zeroBlob, NewBlob: blobB},
+			},
+		},
+		{
+			name: "paths with a tab and a newline",
+			out:  raw("000000", "100644", zeroBlob, blobA, "A", "a\tb.txt") + raw("100644", "100644", blobA, blobB, "R090", "c\nd.txt", "e f.txt"),
+			want: []StagedChange{
+				{Kind: OPERATION_ADD, Path: "a\tb.txt", OldBlob: zeroBlob, NewBlob: blobA},
+				{Kind: OPERATION_RENAME, OldPath: "c\nd.txt", Path: "e f.txt", Score: 90, OldBlob: blobA, NewBlob: blobB},
+			},
+		},
+		{
+			name:    "missing destination of a rename",
+			out:     raw("100644", "100644", blobA, blobA, "R100", "moved.txt"),
+			wantErr: true,
+		},
+		{
+			name:    "invalid score",
+			out:     raw("100644", "100644", blobA, blobA, "Rxx", "a", "b"),
+			wantErr: true,
+		},
+		{
+			name:    "not a raw entry",
+			out:     "M\tmain.go\x00",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseStagedChanges(tt.out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseStagedChanges() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("ParseStagedChanges() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNumStat(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    []FileStat
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			out:  "",
+		},
+		{
+			name: "modified and binary",
+			out:  "3\t1\tmain.go\x00-\t-\tlogo.png\x00",
+			want: []FileStat{
+				{Path: "main.go", Added: 3, Deleted: 1},
+				{Path: "logo.png", Binary: true},
+			},
+		},
+		{
+			name: "rename and copy",
+			out:  "0\t0\t\x00moved.txt\x00renamed.txt\x001\t1\t\x00orig.txt\x00copy.txt\x00",
+			want: []FileStat{
+				{OldPath: "moved.txt", Path: "renamed.txt"},
+				{OldPath: "orig.txt", Path: "copy.txt", Added: 1, Deleted: 1},
+			},
+		},
+		{
+			name: "type change and unmerged",
+			out:  "1\t1\tlink\x000\t0\tconflict.txt\x00",
+			want: []FileStat{
+				{Path: "link", Added: 1, Deleted: 1},
+				{Path: "conflict.txt"},
+			},
+		},
+		{
+			name: "paths with a tab and a newline",
+			out:  "1\t0\ta\tb.txt\x001\t0\tc\nd.txt\x002\t2\t\x00e\tf.txt\x00g\nh.txt\x00",
+			want: []FileStat{
+				{Path: "a\tb.txt", Added: 1},
+				{Path: "c\nd.txt", Added: 1},
+				{OldPath: "e\tf.txt", Path: "g\nh.txt", Added: 2, Deleted: 2},
+			},
+		},
+		{
+			name:    "missing paths of a rename",
+			out:     "0\t0\t\x00moved.txt\x00",
+			wantErr: true,
+		},
+		{
+			name:    "invalid count",
+			out:     "x\t0\tmain.go\x00",
+			wantErr: true,
+		},
+		{
+			name:    "not a numstat entry",
+			out:     "main.go\x00",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseNumStat(tt.out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseNumStat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("ParseNumStat() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGitOutput(t *testing.T) {
+	testRepo(t)
+
+	commitFile(t, "moved.txt", "keep\n", "first")
+	if err := os.WriteFile("link", []byte("x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, "add", "link")
+	runGit(t, "commit", "-q", "-m", "second")
+
+	runGit(t, "mv", "moved.txt", "renamed.txt")
+	if err := os.Remove("link"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("renamed.txt", "link"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a\tb.txt", "c\nd.txt"} {
+		if err := os.WriteFile(name, []byte("line\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runGit(t, "add", "-A")
+
+	out, err := exec.Command("git", "diff", "--cached", "--raw", "--no-abbrev", "-z", "-M").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := ParseStagedChanges(string(out))
+	if err != nil {
+		t.Fatalf("ParseStagedChanges() error = %v", err)
+	}
+
+	kinds := make(map[string]GitOperation, len(changes))
+	for _, change := range changes {
+		kinds[change.Path] = change.Kind
+		if change.Kind == OPERATION_RENAME && (change.OldPath != "moved.txt" || change.Score != 100) {
+			t.Errorf("rename = %+v, want moved.txt with score 100", change)
+		}
+	}
+	wantKinds := map[string]GitOperation{
+		"a\tb.txt":    OPERATION_ADD,
+		"c\nd.txt":    OPERATION_ADD,
+		"link":        OPERATION_TYPE,
+		"renamed.txt": OPERATION_RENAME,
+	}
+	if !reflect.DeepEqual(kinds, wantKinds) {
+		t.Errorf("kinds = %q, want %q", kinds, wantKinds)
+	}
+
+	out, err = exec.Command("git", "diff", "--cached", "--numstat", "-z", "-M").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := ParseNumStat(string(out))
+	if err != nil {
+		t.Fatalf("ParseNumStat() error = %v", err)
+	}
+
+	paths := make([]string, 0, len(stats))
+	for _, stat := range stats {
+		paths = append(paths, stat.OldPath+">"+stat.Path)
+	}
+	wantPaths := []string{">a\tb.txt", ">c\nd.txt", ">link", "moved.txt>renamed.txt"}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Errorf("paths = %q, want %q", paths, wantPaths)
+	}
+}
@@ -0,0 +1,291 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CommitInfo describes an existing commit.
+type CommitInfo struct {
+	Hash string
+	// Parents are the object names of the parents, empty for a root commit.
+	Parents []string
+	Message string
+}
+
+// IsMerge reports whether the commit has more than one parent.
+func (ci CommitInfo) IsMerge() bool {
+	return len(ci.Parents) > 1
+}
+
+// ShortHash returns the abbreviated object name of the commit.
+func (ci CommitInfo) ShortHash() string {
+	return ShortHash(ci.Hash)
+}
+
+// Subject returns the first line of the commit message.
+func (ci CommitInfo) Subject() string {
+	subject, _, _ := strings.Cut(ci.Message, "\n")
+	return subject
+}
+
+// ShortHash abbreviates an object name for display.
+func ShortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
+
+// Log lists the commits of the revision range, oldest first.
+func (gc *gitcmd) Log(revRange string) ([]CommitInfo, error) {
+	out, err := exec.Command(
+		"git",
+		"log",
+		"--reverse",
+		"--topo-order",
+		"-z",
+		"--format=%H%x1f%P%x1f%B",
+		"--end-of-options",
+		revRange,
+		"--",
+	).Output()
+
+	if err != nil {
+		return nil, fmt.Errorf("listing the commits of %s: %w", revRange, err)
+	}
+
+	commits := make([]CommitInfo, 0)
+	for _, entry := range strings.Split(string(out), "\x00") {
+		if entry == "" {
+			continue
+		}
+
+		fields := strings.SplitN(entry, "\x1f", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected log entry %q", entry)
+		}
+
+		commits = append(commits, CommitInfo{
+			Hash:    fields[0],
+			Parents: strings.Fields(fields[1]),
+			Message: strings.TrimSpace(fields[2]),
+		})
+	}
+
+	return commits, nil
+}
+
+// PushedCommits returns the commits of the revision range that are reachable from a remote-tracking branch.
+func (gc *gitcmd) PushedCommits(revRange string) ([]string, error) {
+	all, err := revList(revRange)
+	if err != nil {
+		return nil, err
+	}
+
+	// The second --not ends the negation, so that it only applies to the remote-tracking branches.
+	unpushed, err := revList(revRange, "--not", "--remotes", "--not")
+	if err != nil {
+		return nil, err
+	}
+
+	local := make(map[string]bool, len(unpushed))
+	for _, hash := range unpushed {
+		local[hash] = true
+	}
+
+	pushed := make([]string, 0)
+	for _, hash := range all {
+		if !local[hash] {
+			pushed = append(pushed, hash)
+		}
+	}
+
+	return pushed, nil
+}
+
+// Reword replaces the messages of the given commits, keyed by their object names, and moves the current branch
+// to the rewritten history. The trees, the authors and the parents stay as they are, so unlike a rebase the replay
+// never conflicts. Every descendant of a reworded commit up to HEAD is recreated on top of it with its own message.
+// It returns the object name of the new HEAD.
+func (gc *gitcmd) Reword(revRange string, messages map[string]string) (string, error) {
+	head, err := revParse("HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	// The commits below the range stay untouched, everything between them and HEAD is replayed.
+	boundary, err := revList(revRange, "--boundary")
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"rev-list", "--reverse", "--topo-order", "--parents", "HEAD"}
+	for _, hash := range boundary {
+		if strings.HasPrefix(hash, "-") {
+			args = append(args, "^"+strings.TrimPrefix(hash, "-"))
+		}
+	}
+
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("listing the commits to replay: %w", err)
+	}
+
+	replay := make([][]string, 0)
+	onBranch := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		replay = append(replay, fields)
+		onBranch[fields[0]] = true
+	}
+
+	for hash := range messages {
+		if !onBranch[hash] {
+			return "", fmt.Errorf("commit %s is not an ancestor of HEAD", hash)
+		}
+	}
+
+	rewritten := make(map[string]string)
+	for _, fields := range replay {
+		hash, parents := fields[0], fields[1:]
+
+		changed := false
+		newParents := make([]string, len(parents))
+		for i, parent := range parents {
+			newParents[i] = parent
+			if newParent, ok := rewritten[parent]; ok {
+				newParents[i] = newParent
+				changed = true
+			}
+		}
+
+		message, reworded := messages[hash]
+		if !reworded && !changed {
+			continue
+		}
+
+		newHash, err := recreateCommit(hash, newParents, message, reworded)
+		if err != nil {
+			return "", err
+		}
+		rewritten[hash] = newHash
+	}
+
+	newHead, ok := rewritten[head]
+	if !ok {
+		return head, nil
+	}
+
+	if err := exec.Command(
+		"git",
+		"update-ref",
+		"-m",
+		"git-gpt: reword",
+		"HEAD",
+		newHead,
+		head,
+	).Run(); err != nil {
+		return "", fmt.Errorf("moving HEAD to %s: %w", newHead, err)
+	}
+
+	return newHead, nil
+}
+
+// recreateCommit creates a copy of the commit with the given parents, and the given message if reworded is set.
+func recreateCommit(hash string, parents []string, message string, reworded bool) (string, error) {
+	out, err := exec.Command(
+		"git",
+		"log",
+		"-1",
+		"--date=raw",
+		"--format=%T%x00%an%x00%ae%x00%ad%x00%B",
+		hash,
+	).Output()
+
+	if err != nil {
+		return "", fmt.Errorf("reading commit %s: %w", hash, err)
+	}
+
+	fields := strings.SplitN(string(out), "\x00", 5)
+	if len(fields) != 5 {
+		return "", fmt.Errorf("unexpected format of commit %s", hash)
+	}
+
+	if !reworded {
+		message = fields[4]
+	}
+
+	args := []string{"commit-tree", fields[0]}
+	for _, parent := range parents {
+		args = append(args, "-p", parent)
+	}
+	args = append(args, "-F", "-")
+
+	cmd := exec.Command("git", args...)
+	cmd.Env = append(
+		os.Environ(),
+		"GIT_AUTHOR_NAME="+fields[1],
+		"GIT_AUTHOR_EMAIL="+fields[2],
+		"GIT_AUTHOR_DATE=@"+fields[3],
+	)
+	cmd.Stdin = strings.NewReader(strings.TrimSpace(message) + "\n")
+
+	newHash, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("recreating commit %s: %w", hash, err)
+	}
+
+	return strings.TrimSpace(string(newHash)), nil
+}
+
+// revParse returns the object name of the revision.
+func revParse(rev string) (string, error) {
+	out, err := exec.Command("git", "rev-parse", "--verify", "--quiet", rev).Output()
+	if err != nil {
+		return "", fmt.Errorf("unknown revision %s", rev)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// revList returns the object names listed by git rev-list for the revision range. The extra options come first,
+// the range follows --end-of-options so that it is never taken for an option.
+func revList(revRange string, extra ...string) ([]string, error) {
+	args := append([]string{"rev-list"}, extra...)
+	args = append(args, "--end-of-options", revRange)
+
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing the commits of %s: %w", revRange, err)
+	}
+
+	return strings.Fields(string(out)), nil
+}
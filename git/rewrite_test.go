@@ -0,0 +1,185 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package git
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// testRepo creates a repository in a temporary directory and makes it the working directory of the test,
+// the git helper always works on the current directory.
+func testRepo(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "Ada")
+	t.Setenv("GIT_AUTHOR_EMAIL", "ada@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Bob")
+	t.Setenv("GIT_COMMITTER_EMAIL", "bob@example.com")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	runGit(t, "init", "-q", "-b", "main")
+}
+
+// runGit runs git in the working directory and returns its trimmed output.
+func runGit(t *testing.T, args ...string) string {
+	t.Helper()
+
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commitFile commits the file with the content and returns the object name of the commit.
+func commitFile(t *testing.T, name, content, message string) string {
+	t.Helper()
+
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, "add", name)
+	runGit(t, "commit", "-q", "-m", message)
+	return runGit(t, "rev-parse", "HEAD")
+}
+
+func TestReword(t *testing.T) {
+	testRepo(t)
+
+	c1 := commitFile(t, "a.txt", "1", "first")
+	c2 := commitFile(t, "b.txt", "2", "second")
+	c3 := commitFile(t, "c.txt", "3", "third")
+	c4 := commitFile(t, "d.txt", "4", "fourth")
+	tree := runGit(t, "rev-parse", "HEAD^{tree}")
+
+	gc := New()
+
+	// Only the second commit is in the range, the two after it have to be replayed on top of the new one.
+	newHead, err := gc.Reword("HEAD~3..HEAD~2", map[string]string{c2: "Second, reworded\n\nWith a body."})
+	if err != nil {
+		t.Fatalf("Reword() error = %v", err)
+	}
+
+	if head := runGit(t, "rev-parse", "HEAD"); head != newHead || head == c4 {
+		t.Errorf("HEAD = %s, want the new head %s", head, newHead)
+	}
+	if got := runGit(t, "rev-parse", "HEAD^{tree}"); got != tree {
+		t.Errorf("the tree of HEAD changed from %s to %s", tree, got)
+	}
+	if got := runGit(t, "rev-parse", "HEAD~3"); got != c1 {
+		t.Errorf("the commit below the range changed from %s to %s", c1, got)
+	}
+
+	if got, want := runGit(t, "log", "--format=%s", "main"), "fourth\nthird\nSecond, reworded\nfirst"; got != want {
+		t.Errorf("log = %q, want %q", got, want)
+	}
+	if got := runGit(t, "log", "-1", "--format=%b", "HEAD~2"); got != "With a body." {
+		t.Errorf("body = %q", got)
+	}
+	if got := runGit(t, "log", "--format=%an <%ae>", "-1", "HEAD~2"); got != "Ada <ada@example.com>" {
+		t.Errorf("author = %q, want it kept", got)
+	}
+	if got := runGit(t, "rev-parse", "HEAD~1"); got == c3 {
+		t.Error("the descendant of the reworded commit was not replayed")
+	}
+	if got := runGit(t, "reflog", "-1", "--format=%gs"); got != "git-gpt: reword" {
+		t.Errorf("reflog = %q", got)
+	}
+}
+
+func TestRewordLinearRange(t *testing.T) {
+	testRepo(t)
+
+	commitFile(t, "a.txt", "1", "first")
+	c2 := commitFile(t, "b.txt", "2", "second")
+	c3 := commitFile(t, "c.txt", "3", "third")
+
+	newHead, err := New().Reword("HEAD~2..HEAD", map[string]string{c2: "two", c3: "three"})
+	if err != nil {
+		t.Fatalf("Reword() error = %v", err)
+	}
+
+	if got, want := runGit(t, "log", "--format=%s", newHead), "three\ntwo\nfirst"; got != want {
+		t.Errorf("log = %q, want %q", got, want)
+	}
+
+	// Nothing to reword leaves HEAD alone.
+	head, err := New().Reword("HEAD~1..HEAD", nil)
+	if err != nil || head != newHead {
+		t.Errorf("Reword() without messages = %s, %v, want %s", head, err, newHead)
+	}
+}
+
+func TestRewordRefusesNonAncestor(t *testing.T) {
+	testRepo(t)
+
+	commitFile(t, "a.txt", "1", "first")
+	runGit(t, "checkout", "-q", "-b", "side")
+	side := commitFile(t, "side.txt", "x", "side")
+	runGit(t, "checkout", "-q", "main")
+	head := commitFile(t, "b.txt", "2", "second")
+
+	_, err := New().Reword("HEAD~1..HEAD", map[string]string{side: "stolen"})
+	if err == nil || !strings.Contains(err.Error(), "not an ancestor of HEAD") {
+		t.Errorf("Reword() error = %v, want a non-ancestor error", err)
+	}
+	if got := runGit(t, "rev-parse", "HEAD"); got != head {
+		t.Errorf("HEAD moved from %s to %s", head, got)
+	}
+}
+
+func TestPushedCommits(t *testing.T) {
+	testRepo(t)
+
+	commitFile(t, "a.txt", "1", "first")
+	c2 := commitFile(t, "b.txt", "2", "second")
+	runGit(t, "update-ref", "refs/remotes/origin/main", c2)
+	commitFile(t, "c.txt", "3", "third")
+
+	pushed, err := New().PushedCommits("HEAD~2..HEAD")
+	if err != nil {
+		t.Fatalf("PushedCommits() error = %v", err)
+	}
+	if len(pushed) != 1 || pushed[0] != c2 {
+		t.Errorf("PushedCommits() = %v, want [%s]", pushed, c2)
+	}
+
+	// A range that looks like an option is taken as a revision.
+	if _, err := New().PushedCommits("--all"); err == nil {
+		t.Error("PushedCommits(--all) did not fail")
+	}
+}
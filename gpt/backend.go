@@ -0,0 +1,128 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Backend sends chat completion requests to a model provider.
+// Requests and responses use the OpenAI types, every other provider maps them to its own protocol.
+type Backend interface {
+	CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+	// CreateChatCompletionStream calls onDelta for every received piece of content and returns the assembled response.
+	// When the stream breaks off, the content received so far is returned together with the error.
+	CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest, onDelta func(string)) (openai.ChatCompletionResponse, error)
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// Ensure, that openAIBackend does implement Backend.
+var _ Backend = &openAIBackend{}
+
+// openAIBackend talks to OpenAI and Azure OpenAI.
+type openAIBackend struct {
+	client *openai.Client
+}
+
+func (b *openAIBackend) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	return b.client.CreateChatCompletion(ctx, req)
+}
+
+func (b *openAIBackend) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest, onDelta func(string)) (openai.ChatCompletionResponse, error) {
+	result := openai.ChatCompletionResponse{
+		Object: "chat.completion",
+		Model:  req.Model,
+	}
+
+	stream, err := b.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return result, err
+	}
+	defer stream.Close()
+
+	var content strings.Builder
+	var finishReason openai.FinishReason
+
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			result.Choices = assembledChoices(content.String(), finishReason)
+			return result, err
+		}
+
+		result.ID = chunk.ID
+		result.Created = chunk.Created
+		for _, choice := range chunk.Choices {
+			if choice.Index != 0 {
+				continue
+			}
+			if choice.Delta.Content != "" {
+				content.WriteString(choice.Delta.Content)
+				onDelta(choice.Delta.Content)
+			}
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+		}
+	}
+
+	// The streaming API does not report token usage, the caller estimates it.
+	result.Choices = assembledChoices(content.String(), finishReason)
+	return result, nil
+}
+
+func (b *openAIBackend) ListModels(ctx context.Context) ([]string, error) {
+	list, err := b.client.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]string, 0, len(list.Models))
+	for _, model := range list.Models {
+		models = append(models, model.ID)
+	}
+
+	return models, nil
+}
+
+// assembledChoices wraps streamed content into the single choice of a regular response.
+func assembledChoices(content string, finishReason openai.FinishReason) []openai.ChatCompletionChoice {
+	return []openai.ChatCompletionChoice{
+		{
+			Index: 0,
+			Message: openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: content,
+			},
+			FinishReason: finishReason,
+		},
+	}
+}
@@ -0,0 +1,97 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"fmt"
+)
+
+// BudgetExceededError is returned when the next request could push the spend of the run over the budget.
+// Nothing is sent once the budget would be exceeded, the error reports how far the run got.
+type BudgetExceededError struct {
+	MaxCost     float64
+	Spent       float64
+	Projected   float64
+	Stage       string
+	NumRequests int
+	NumFiles    int
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf(
+		"budget of $%.4f exceeded: the next %s request could bring the spend to %s, stopped after %d requests and %d summarized files which cost %s",
+		e.MaxCost,
+		e.Stage,
+		formatCost(e.Projected),
+		e.NumRequests,
+		e.NumFiles,
+		formatCost(e.Spent),
+	)
+}
+
+// Cost returns the estimated cost in USD of the given number of tokens.
+func (m ModelInfo) Cost(promptTokens, completionTokens int) float64 {
+	return float64(promptTokens)/1000*m.PromptPrice + float64(completionTokens)/1000*m.CompletionPrice
+}
+
+// maxCompletionTokens is the largest answer a request can get.
+func (c *client) maxCompletionTokens() int {
+	if c.maxTokens > 0 {
+		return c.maxTokens
+	}
+	return c.modelInfo.MaxOutputTokens
+}
+
+// reserveBudget checks that the worst-case cost of the next request, asking for n answers, fits into the budget
+// and reserves it until the returned release function is called. Requests to models without pricing are never refused.
+func (c *client) reserveBudget(stage string, promptTokens, n int) (func(), error) {
+	if c.maxCost <= 0 || !c.stats.CostKnown {
+		return func() {}, nil
+	}
+
+	cost := c.modelInfo.Cost(promptTokens, n*c.maxCompletionTokens())
+
+	s := c.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	projected := s.Cost + s.reserved + cost
+	if projected > c.maxCost {
+		return nil, &BudgetExceededError{
+			MaxCost:     c.maxCost,
+			Spent:       s.Cost,
+			Projected:   projected,
+			Stage:       stage,
+			NumRequests: s.NumRequests,
+			NumFiles:    s.NumFiles,
+		}
+	}
+	s.reserved += cost
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.reserved -= cost
+	}, nil
+}
@@ -0,0 +1,73 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"strconv"
+
+	"github.com/rammstein4o/git-gpt/cache"
+	"github.com/rammstein4o/git-gpt/git"
+	"github.com/rammstein4o/git-gpt/utils"
+)
+
+// summaryCacheKey identifies the summary of a change. Blob names pin the content, the content fingerprint pins how
+// it was diffed and redacted, while the template version, model and chunk size pin everything else that shapes
+// the answer.
+func (c *client) summaryCacheKey(templateName string, change git.StagedChange) string {
+	return cache.Key(
+		templateName,
+		string(change.Kind),
+		change.OldPath,
+		change.Path,
+		change.OldBlob,
+		change.NewBlob,
+		utils.TemplateVersion(templateName, PrevChunkSummaryTemplate),
+		c.model,
+		strconv.Itoa(c.maxChunkSize),
+		c.fingerprint,
+	)
+}
+
+// cachedSummary returns the cached summary of the change, or produces it with summarize and stores it.
+// Changes without blob names can not be identified reliably and are never cached.
+func (c *client) cachedSummary(templateName string, change git.StagedChange, summarize func() (string, error)) (string, error) {
+	if c.cache == nil || change.NewBlob == "" && change.OldBlob == "" {
+		return summarize()
+	}
+
+	key := c.summaryCacheKey(templateName, change)
+	if summary, ok := c.cache.Get(key); ok {
+		c.stats.addCacheHit()
+		return summary, nil
+	}
+
+	summary, err := summarize()
+	if err != nil {
+		return "", err
+	}
+
+	// A failing cache must never fail the run, the summary is simply not reused next time.
+	_ = c.cache.Put(key, summary)
+
+	return summary, nil
+}
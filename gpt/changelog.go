@@ -0,0 +1,243 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rammstein4o/git-gpt/git"
+	"github.com/rammstein4o/git-gpt/utils"
+)
+
+// Kinds of changelog entries, in the order their sections appear.
+const (
+	CHANGELOG_BREAKING = "breaking"
+	CHANGELOG_FEATURE  = "feature"
+	CHANGELOG_FIX      = "fix"
+	CHANGELOG_CHORE    = "chore"
+)
+
+// changelogSections maps every kind of entry to its Keep a Changelog section.
+var changelogSections = []struct {
+	kind  string
+	title string
+}{
+	{CHANGELOG_BREAKING, "Breaking Changes"},
+	{CHANGELOG_FEATURE, "Added"},
+	{CHANGELOG_FIX, "Fixed"},
+	{CHANGELOG_CHORE, "Changed"},
+}
+
+// ChangelogEntry is a single commit sorted into the changelog.
+type ChangelogEntry struct {
+	Hash        string
+	Kind        string
+	Scope       string
+	Description string
+}
+
+// ClassifyConventionalCommit sorts a commit by its Conventional Commits header. Unlike ParseConventionalCommit
+// it accepts every header that looks conventional, since old history was never validated.
+func ClassifyConventionalCommit(commit git.CommitInfo) (ChangelogEntry, bool) {
+	header, body, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n")
+
+	m := conventionalHeaderRe.FindStringSubmatch(strings.TrimSpace(header))
+	if m == nil || !isConventionalType(strings.ToLower(m[1])) {
+		return ChangelogEntry{}, false
+	}
+
+	entry := ChangelogEntry{
+		Hash:        commit.Hash,
+		Scope:       strings.TrimSpace(m[2]),
+		Description: strings.TrimSpace(m[4]),
+	}
+
+	switch {
+	case m[3] == "!" || breakingChangeFooterRe.MatchString(body):
+		entry.Kind = CHANGELOG_BREAKING
+	case strings.ToLower(m[1]) == "feat":
+		entry.Kind = CHANGELOG_FEATURE
+	case strings.ToLower(m[1]) == "fix":
+		entry.Kind = CHANGELOG_FIX
+	default:
+		entry.Kind = CHANGELOG_CHORE
+	}
+
+	return entry, true
+}
+
+// changelogClassification is a single commit classified by the model.
+type changelogClassification struct {
+	Index       int    `json:"index"`
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+}
+
+// ClassifyCommits sorts commits without a conventional header by asking the model, in batches of at most the
+// chunk size. The entries keep the order of the commits. A commit the model skipped or sorted into an unknown kind
+// ends up as a chore with its original subject.
+func (c *client) ClassifyCommits(ctx context.Context, commits []git.CommitInfo) ([]ChangelogEntry, error) {
+	entries := make([]ChangelogEntry, len(commits))
+	for i, commit := range commits {
+		entries[i] = ChangelogEntry{
+			Hash:        commit.Hash,
+			Kind:        CHANGELOG_CHORE,
+			Description: commit.Subject(),
+		}
+	}
+
+	systemMsg, err := utils.GetTemplateByString(
+		ClassifyCommitsTemplate,
+		utils.Data{},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	systemMsgs := []string{systemMsg}
+
+	languageMsg, err := c.languageMessage()
+	if err != nil {
+		return nil, err
+	}
+	if languageMsg != "" {
+		systemMsgs = append(systemMsgs, languageMsg)
+	}
+
+	classify := func(first int, prompt string) error {
+		completion, err := c.complete(ctx, STAGE_CHANGELOG, prompt, systemMsgs...)
+		if err != nil {
+			return err
+		}
+
+		for _, cl := range parseChangelogClassifications(completion) {
+			i := first + cl.Index - 1
+			if i < first || i >= len(entries) {
+				continue
+			}
+			switch cl.Kind {
+			case CHANGELOG_BREAKING, CHANGELOG_FEATURE, CHANGELOG_FIX, CHANGELOG_CHORE:
+				entries[i].Kind = cl.Kind
+			}
+			if description := strings.TrimSpace(cl.Description); description != "" {
+				entries[i].Description = description
+			}
+		}
+		return nil
+	}
+
+	// The commits are numbered from 1 within every batch.
+	first := 0
+	prompt := ""
+	promptTokens := 0
+	for i, commit := range commits {
+		itemTokens := c.countTextTokens(commit.Message + "\n")
+		if promptTokens > 0 && promptTokens+itemTokens > c.maxChunkSize {
+			if err := classify(first, prompt); err != nil {
+				return nil, err
+			}
+
+			first = i
+			prompt = ""
+			promptTokens = 0
+		}
+
+		prompt += fmt.Sprintf("%d. %s\n", i-first+1, commit.Message)
+		promptTokens += itemTokens
+	}
+
+	if prompt != "" {
+		if err := classify(first, prompt); err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// parseChangelogClassifications extracts the JSON array of classifications from the model answer.
+func parseChangelogClassifications(answer string) []changelogClassification {
+	answer = strings.TrimSpace(answer)
+
+	start := strings.Index(answer, "[")
+	end := strings.LastIndex(answer, "]")
+	if start == -1 || end <= start {
+		return nil
+	}
+
+	var classifications []changelogClassification
+	if err := json.Unmarshal([]byte(answer[start:end+1]), &classifications); err != nil {
+		return nil
+	}
+
+	for i := range classifications {
+		classifications[i].Kind = strings.ToLower(strings.TrimSpace(classifications[i].Kind))
+	}
+	return classifications
+}
+
+// RenderChangelog renders the entries as a Keep a Changelog section. The heading is "[Unreleased]" without a version,
+// the date is left out when empty.
+func RenderChangelog(version, date string, entries []ChangelogEntry) string {
+	var sb strings.Builder
+
+	heading := "## [Unreleased]"
+	if version != "" {
+		heading = fmt.Sprintf("## [%s]", version)
+		if date != "" {
+			heading += " - " + date
+		}
+	}
+	sb.WriteString(heading + "\n")
+
+	for _, section := range changelogSections {
+		lines := make([]string, 0)
+		for _, entry := range entries {
+			if entry.Kind != section.kind {
+				continue
+			}
+
+			line := "- "
+			if entry.Scope != "" {
+				line += "**" + entry.Scope + ":** "
+			}
+			line += entry.Description
+			if entry.Hash != "" {
+				line += " (" + git.ShortHash(entry.Hash) + ")"
+			}
+			lines = append(lines, line)
+		}
+
+		if len(lines) == 0 {
+			continue
+		}
+
+		sb.WriteString("\n### " + section.title + "\n\n")
+		sb.WriteString(strings.Join(lines, "\n") + "\n")
+	}
+
+	return sb.String()
+}
@@ -25,78 +25,19 @@ package gpt
 import (
 	"context"
 	"fmt"
-	"log"
+	"io"
+	"net/http"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/pkoukk/tiktoken-go"
+	"github.com/rammstein4o/git-gpt/cache"
 	"github.com/rammstein4o/git-gpt/git"
 	"github.com/rammstein4o/git-gpt/utils"
 	"github.com/sashabaranov/go-openai"
 )
 
-var (
-	tokensMap = map[string]int{
-		"gpt-4-32k-0613":         32768,
-		"gpt-4-32k-0314":         32768,
-		"gpt-4-32k":              32768,
-		"gpt-4-0613":             8192,
-		"gpt-4-0314":             8192,
-		"gpt-4":                  8192,
-		"gpt-3.5-turbo-0613":     4096,
-		"gpt-3.5-turbo-0301":     4096,
-		"gpt-3.5-turbo-16k":      16384,
-		"gpt-3.5-turbo-16k-0613": 16384,
-		"gpt-3.5-turbo":          4096,
-		"gpt-3.5-turbo-instruct": 4096,
-	}
-)
-
-func countTokens(model string, messages ...openai.ChatCompletionMessage) (int, error) {
-	tkm, err := tiktoken.EncodingForModel(model)
-	if err != nil {
-		return 0, err
-	}
-
-	var tokensPerMessage, tokensPerName int
-	switch model {
-	case "gpt-3.5-turbo-0613",
-		"gpt-3.5-turbo-16k-0613",
-		"gpt-4-0314",
-		"gpt-4-32k-0314",
-		"gpt-4-0613",
-		"gpt-4-32k-0613":
-		tokensPerMessage = 3
-		tokensPerName = 1
-	case "gpt-3.5-turbo-0301":
-		tokensPerMessage = 4 // every message follows <|start|>{role/name}\n{content}<|end|>\n
-		tokensPerName = -1   // if there's a name, the role is omitted
-	default:
-		if strings.Contains(model, "gpt-3.5-turbo") {
-			log.Println("warning: gpt-3.5-turbo may update over time. Returning num tokens assuming gpt-3.5-turbo-0613.")
-			return countTokens("gpt-3.5-turbo-0613", messages...)
-		} else if strings.Contains(model, "gpt-4") {
-			log.Println("warning: gpt-4 may update over time. Returning num tokens assuming gpt-4-0613.")
-			return countTokens("gpt-4-0613", messages...)
-		}
-		return 0, fmt.Errorf("not implemented for model %s", model)
-	}
-
-	numTokens := 0
-	for _, msg := range messages {
-		numTokens += tokensPerMessage
-		numTokens += len(tkm.Encode(msg.Content, nil, nil))
-		numTokens += len(tkm.Encode(msg.Role, nil, nil))
-		numTokens += len(tkm.Encode(msg.Name, nil, nil))
-		if msg.Name != "" {
-			numTokens += tokensPerName
-		}
-	}
-	// every reply is primed with <|start|>assistant<|message|>
-	numTokens += 3
-	return numTokens, nil
-}
-
 func getDeveloperTypeByExtension(fileName string) string {
 	var devType string
 
@@ -151,11 +92,39 @@ func getDeveloperTypeByExtension(fileName string) string {
 	return "expert programmer"
 }
 
+// DescribeChange returns a short human readable description of a staged change, e.g. "Moved `a.go` to `b.go` (plus edits)".
+func DescribeChange(change git.StagedChange) string {
+	switch change.Kind {
+	case git.OPERATION_ADD:
+		return fmt.Sprintf("Added file `%s`", change.Path)
+	case git.OPERATION_DEL:
+		return fmt.Sprintf("Removed file `%s`", change.Path)
+	case git.OPERATION_RENAME, git.OPERATION_COPY:
+		verb := "Moved"
+		if change.Kind == git.OPERATION_COPY {
+			verb = "Copied"
+		}
+		if change.Score >= 100 {
+			return fmt.Sprintf("%s `%s` to `%s`", verb, change.OldPath, change.Path)
+		}
+		return fmt.Sprintf("%s `%s` to `%s` (plus edits)", verb, change.OldPath, change.Path)
+	case git.OPERATION_TYPE:
+		return fmt.Sprintf("Changed type of file `%s`", change.Path)
+	default:
+		return fmt.Sprintf("Modified file `%s`", change.Path)
+	}
+}
+
 type Gpt interface {
-	SummarizeFile(ctx context.Context, op git.GitOperation, fileName, fileContent string) (string, error)
-	SummarizeDiff(ctx context.Context, fileName, diff string) (string, error)
+	SummarizeFile(ctx context.Context, change git.StagedChange, fileContent string) (string, error)
+	SummarizeDiff(ctx context.Context, change git.StagedChange, diff string) (string, error)
 	SummarizeChanges(ctx context.Context, changes []string) (string, error)
-	FinalizeCommitMsg(ctx context.Context, prompt string) (string, error)
+	FinalizeCommitMsg(ctx context.Context, prompt string, hints CommitHints) (string, error)
+	FinalizeCommitMsgCandidates(ctx context.Context, prompt string, hints CommitHints, n int) ([]string, error)
+	ReviewDiff(ctx context.Context, fileName, diff string) ([]ReviewFinding, error)
+	DescribePullRequest(ctx context.Context, commitLog string, changes []string) (PullRequest, error)
+	ClassifyCommits(ctx context.Context, commits []git.CommitInfo) ([]ChangelogEntry, error)
+	ListModels(ctx context.Context) ([]string, error)
 	GetStats(ctx context.Context) *Stats
 }
 
@@ -165,15 +134,35 @@ var _ Gpt = &client{}
 type client struct {
 	model        string
 	stream       bool
+	streamWriter io.Writer
 	maxTokens    int
 	temperature  float32
 	topP         float32
 	maxChunkSize int
-	client       *openai.Client
-	stats        *Stats
+	maxCost      float64
+	models       ModelCatalog
+	modelInfo    ModelInfo
+	commitStyle  string
+	language     string
+	cache        *cache.Cache
+	fingerprint  string
+	backend      Backend
+	newBackend   func(httpClient *http.Client) Backend
+
+	maxRetries     int
+	requestTimeout time.Duration
+	retryNotify    RetryNotifyFunc
+
+	// dryRun receives the requests instead of the backend when set.
+	dryRun         io.Writer
+	dryRunMu       sync.Mutex
+	dryRunRequests int
+
+	stats *Stats
 }
 
-func (c *client) createChatCompletion(ctx context.Context, content string, systemMessages ...string) (openai.ChatCompletionResponse, error) {
+// newChatCompletionRequest builds the request for the given prompt and checks it against the token limit of the model.
+func (c *client) newChatCompletionRequest(content string, systemMessages ...string) (openai.ChatCompletionRequest, int, error) {
 	messages := make([]openai.ChatCompletionMessage, 0)
 
 	for _, msg := range systemMessages {
@@ -188,42 +177,93 @@ func (c *client) createChatCompletion(ctx context.Context, content string, syste
 		Content: strings.TrimSpace(content),
 	})
 
-	tokenLimit := tokensMap[c.model]
-	numTokens, _ := countTokens(c.model, messages...)
+	tokenLimit := c.modelInfo.ContextWindow
+	numTokens := countTokens(c.modelInfo, messages...)
 	if numTokens > tokenLimit-c.maxTokens {
-		return openai.ChatCompletionResponse{}, fmt.Errorf("too many tokens used %d (%d)", numTokens, tokenLimit)
+		return openai.ChatCompletionRequest{}, 0, fmt.Errorf("too many tokens used %d (%d)", numTokens, tokenLimit)
 	}
 
-	req := openai.ChatCompletionRequest{
+	return openai.ChatCompletionRequest{
 		Model:       c.model,
 		Messages:    messages,
-		Stream:      c.stream,
 		N:           1,
 		MaxTokens:   c.maxTokens,
 		Temperature: c.temperature,
 		TopP:        c.topP,
+	}, numTokens, nil
+}
+
+// addUsage records the usage of a request of the given stage together with its estimated cost.
+func (c *client) addUsage(stage string, usage openai.Usage) {
+	c.stats.addUsage(stage, usage, c.modelInfo.Cost(usage.PromptTokens, usage.CompletionTokens))
+}
+
+// complete sends a single chat completion request, records its token usage and returns the trimmed answer.
+func (c *client) complete(ctx context.Context, stage, content string, systemMessages ...string) (string, error) {
+	answers, err := c.completeN(ctx, stage, 1, content, systemMessages...)
+	if err != nil {
+		return "", err
 	}
 
-	return c.client.CreateChatCompletion(ctx, req)
+	return answers[0], nil
 }
 
-func (c *client) SummarizeFile(ctx context.Context, op git.GitOperation, fileName, fileContent string) (string, error) {
-	result := make([]string, 0)
+// completeN asks for n alternative answers to the same prompt and records the token usage of all of them.
+// Backends that ignore n answer only once, the missing answers are then requested with further calls.
+func (c *client) completeN(ctx context.Context, stage string, n int, content string, systemMessages ...string) ([]string, error) {
+	req, promptTokens, err := c.newChatCompletionRequest(content, systemMessages...)
+	if err != nil {
+		return nil, err
+	}
 
-	var str string
-	switch op {
-	case git.OPERATION_ADD:
-		str = "Added"
-	case git.OPERATION_DEL:
-		str = "Removed"
-	default:
-		str = "Modified"
+	answers := make([]string, 0, n)
+	for len(answers) < n {
+		req.N = n - len(answers)
+
+		var resp openai.ChatCompletionResponse
+		if c.dryRun != nil {
+			resp = c.dryRunCompletion(stage, req, promptTokens)
+		} else {
+			release, err := c.reserveBudget(stage, promptTokens, req.N)
+			if err != nil {
+				return nil, err
+			}
+
+			resp, err = c.backend.CreateChatCompletion(ctx, req)
+			release()
+			if err != nil {
+				return nil, err
+			}
+		}
+		c.addUsage(stage, resp.Usage)
+
+		if len(resp.Choices) == 0 {
+			return nil, fmt.Errorf("empty completion returned for model %s", c.model)
+		}
+
+		for _, choice := range resp.Choices {
+			answers = append(answers, strings.TrimSpace(choice.Message.Content))
+		}
 	}
 
-	result = append(result, fmt.Sprintf("%s file `%s`: ", str, fileName))
+	return answers[:n], nil
+}
+
+func (c *client) SummarizeFile(ctx context.Context, change git.StagedChange, fileContent string) (string, error) {
+	return c.cachedSummary(SummarizeFileTemplate, change, func() (string, error) {
+		return c.summarizeFile(ctx, change, fileContent)
+	})
+}
+
+func (c *client) summarizeFile(ctx context.Context, change git.StagedChange, fileContent string) (string, error) {
+	op := change.Kind
+	fileName := change.Path
+
+	result := make([]string, 0)
+	result = append(result, DescribeChange(change)+": ")
 
 	prevChunkSummary := ""
-	chunks := utils.SplitText(fileContent, c.maxChunkSize)
+	chunks := utils.SplitLines(fileContent, c.maxChunkSize, c.countTextTokens)
 	for _, chunk := range chunks {
 		systemMsgs := make([]string, 0)
 		tmpMsg, err := utils.GetTemplateByString(
@@ -255,29 +295,32 @@ func (c *client) SummarizeFile(ctx context.Context, op git.GitOperation, fileNam
 			systemMsgs = append(systemMsgs, tmpMsg)
 		}
 
-		resp, err := c.createChatCompletion(ctx, chunk, systemMsgs...)
+		completion, err := c.complete(ctx, STAGE_SUMMARIZE_FILE, chunk, systemMsgs...)
 		if err != nil {
 			return "", err
 		}
-		c.stats.NumRequests += 1
-		c.stats.PromptTokens += resp.Usage.PromptTokens
-		c.stats.CompletionTokens += resp.Usage.CompletionTokens
-		c.stats.TotalTokens += resp.Usage.TotalTokens
-		completion := strings.TrimSpace(resp.Choices[0].Message.Content)
 		prevChunkSummary = completion
 		result = append(result, completion)
 	}
 
-	c.stats.NumFiles += 1
+	c.stats.addFile()
 	return strings.TrimSpace(strings.Join(result, " ")), nil
 }
 
-func (c *client) SummarizeDiff(ctx context.Context, fileName, diff string) (string, error) {
+func (c *client) SummarizeDiff(ctx context.Context, change git.StagedChange, diff string) (string, error) {
+	return c.cachedSummary(SummarizeDiffTemplate, change, func() (string, error) {
+		return c.summarizeDiff(ctx, change, diff)
+	})
+}
+
+func (c *client) summarizeDiff(ctx context.Context, change git.StagedChange, diff string) (string, error) {
+	fileName := change.Path
+
 	result := make([]string, 0)
-	result = append(result, fmt.Sprintf("Modified file `%s`: ", fileName))
+	result = append(result, DescribeChange(change)+": ")
 
 	prevChunkSummary := ""
-	chunks := utils.SplitText(diff, c.maxChunkSize)
+	chunks := utils.SplitDiff(diff, c.maxChunkSize, c.countTextTokens)
 	for _, chunk := range chunks {
 		systemMsgs := make([]string, 0)
 		tmpMsg, err := utils.GetTemplateByString(
@@ -308,87 +351,156 @@ func (c *client) SummarizeDiff(ctx context.Context, fileName, diff string) (stri
 			systemMsgs = append(systemMsgs, tmpMsg)
 		}
 
-		resp, err := c.createChatCompletion(ctx, chunk, systemMsgs...)
+		completion, err := c.complete(ctx, STAGE_SUMMARIZE_DIFF, chunk, systemMsgs...)
 		if err != nil {
 			return "", err
 		}
-		c.stats.NumRequests += 1
-		c.stats.PromptTokens += resp.Usage.PromptTokens
-		c.stats.CompletionTokens += resp.Usage.CompletionTokens
-		c.stats.TotalTokens += resp.Usage.TotalTokens
-		completion := strings.TrimSpace(resp.Choices[0].Message.Content)
 		prevChunkSummary = completion
 		result = append(result, completion)
 	}
 
-	c.stats.NumFiles += 1
+	c.stats.addFile()
 	return strings.TrimSpace(strings.Join(result, " ")), nil
 }
 
 func (c *client) SummarizeChanges(ctx context.Context, changes []string) (string, error) {
 	systemMsg, err := utils.GetTemplateByString(
 		SummarizeChangesTemplate,
-		utils.Data{},
+		c.languageData(),
 	)
 	if err != nil {
 		return "", err
 	}
 
 	prompt := ""
+	promptTokens := 0
 	result := make([]string, 0)
 
 	for _, summary := range changes {
-		if len(prompt)+len(summary) > c.maxChunkSize {
-			resp, err := c.createChatCompletion(ctx, prompt, systemMsg)
+		summaryTokens := c.countTextTokens(summary + "\n")
+		if promptTokens > 0 && promptTokens+summaryTokens > c.maxChunkSize {
+			completion, err := c.complete(ctx, STAGE_SUMMARIZE_CHANGES, prompt, systemMsg)
 			if err != nil {
 				return "", err
 			}
-			c.stats.NumRequests += 1
-			c.stats.PromptTokens += resp.Usage.PromptTokens
-			c.stats.CompletionTokens += resp.Usage.CompletionTokens
-			c.stats.TotalTokens += resp.Usage.TotalTokens
-			result = append(result, strings.TrimSpace(resp.Choices[0].Message.Content))
+			result = append(result, completion)
 
 			prompt = ""
+			promptTokens = 0
 		}
 
 		prompt = fmt.Sprintf("%s\n%s", prompt, summary)
+		promptTokens += summaryTokens
 	}
 
 	if strings.TrimSpace(prompt) != "" {
-		resp, err := c.createChatCompletion(ctx, prompt, systemMsg)
+		completion, err := c.complete(ctx, STAGE_SUMMARIZE_CHANGES, prompt, systemMsg)
 		if err != nil {
 			return "", err
 		}
-		c.stats.NumRequests += 1
-		c.stats.PromptTokens += resp.Usage.PromptTokens
-		c.stats.CompletionTokens += resp.Usage.CompletionTokens
-		c.stats.TotalTokens += resp.Usage.TotalTokens
-		result = append(result, strings.TrimSpace(resp.Choices[0].Message.Content))
+		result = append(result, completion)
 	}
 
 	return strings.TrimSpace(strings.Join(result, "\n")), nil
 }
 
-func (c *client) FinalizeCommitMsg(ctx context.Context, prompt string) (string, error) {
+func (c *client) FinalizeCommitMsg(ctx context.Context, prompt string, hints CommitHints) (string, error) {
+	candidates, err := c.FinalizeCommitMsgCandidates(ctx, prompt, hints, 1)
+	if err != nil {
+		return "", err
+	}
+
+	return candidates[0], nil
+}
+
+// FinalizeCommitMsgCandidates generates n alternative commit messages. Only a single message is ever streamed.
+func (c *client) FinalizeCommitMsgCandidates(ctx context.Context, prompt string, hints CommitHints, n int) ([]string, error) {
+	if n < 1 {
+		n = 1
+	}
+
 	systemMsg, err := utils.GetTemplateByString(
 		SummarizeChangesTemplate,
-		utils.Data{},
+		c.languageData(),
 	)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	systemMsgs := []string{systemMsg}
+
+	if hints.PreviousMessage != "" {
+		tmpMsg, err := utils.GetTemplateByString(
+			PreviousMessageTemplate,
+			utils.Data{
+				"message": hints.PreviousMessage,
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		systemMsgs = append(systemMsgs, tmpMsg)
 	}
 
-	resp, err := c.createChatCompletion(ctx, prompt, systemMsg)
+	if hints.Instruction != "" {
+		tmpMsg, err := utils.GetTemplateByString(
+			UserInstructionTemplate,
+			utils.Data{
+				"instruction": hints.Instruction,
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		systemMsgs = append(systemMsgs, tmpMsg)
+	}
+
+	// Only the final message is translated, the summaries it is based on stay in English.
+	languageMsg, err := c.languageMessage()
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if languageMsg != "" {
+		systemMsgs = append(systemMsgs, languageMsg)
+	}
+
+	// Every conventional candidate is validated and retried on its own.
+	if c.commitStyle == COMMIT_STYLE_CONVENTIONAL {
+		candidates := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			candidate, err := c.finalizeConventionalCommitMsg(ctx, prompt, hints, n == 1, systemMsgs...)
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, candidate)
+		}
+		return candidates, nil
 	}
-	c.stats.NumRequests += 1
-	c.stats.PromptTokens += resp.Usage.PromptTokens
-	c.stats.CompletionTokens += resp.Usage.CompletionTokens
-	c.stats.TotalTokens += resp.Usage.TotalTokens
 
-	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+	if n == 1 {
+		commitMsg, err := c.completeFinal(ctx, prompt, true, systemMsgs...)
+		if err != nil {
+			return nil, err
+		}
+		return []string{commitMsg}, nil
+	}
+
+	return c.completeN(ctx, STAGE_FINALIZE, n, prompt, systemMsgs...)
+}
+
+// completeFinal requests the final commit message, streaming it when enabled and allowed.
+func (c *client) completeFinal(ctx context.Context, prompt string, allowStream bool, systemMessages ...string) (string, error) {
+	if c.stream && allowStream {
+		return c.completeStream(ctx, STAGE_FINALIZE, prompt, systemMessages...)
+	}
+
+	return c.complete(ctx, STAGE_FINALIZE, prompt, systemMessages...)
+}
+
+func (c *client) ListModels(ctx context.Context) ([]string, error) {
+	return c.backend.ListModels(ctx)
 }
 
 func (c *client) GetStats(ctx context.Context) *Stats {
@@ -397,7 +509,10 @@ func (c *client) GetStats(ctx context.Context) *Stats {
 
 func New(opts ...Option) Gpt {
 	cl := &client{
-		stats: &Stats{},
+		models:         DefaultModels,
+		maxRetries:     DefaultMaxRetries,
+		requestTimeout: DefaultRequestTimeout,
+		stats:          &Stats{},
 	}
 
 	// Loop through each option passed as argument and apply it to the config object
@@ -405,5 +520,19 @@ func New(opts ...Option) Gpt {
 		fn(cl)
 	}
 
+	if cl.newBackend != nil {
+		cl.backend = cl.newBackend(&http.Client{
+			Transport: newRetryTransport(http.DefaultTransport, cl.maxRetries, cl.requestTimeout, cl.retryNotify),
+		})
+	}
+
+	// Nothing arrives to be streamed in a dry run.
+	if cl.dryRun != nil {
+		cl.stream = false
+	}
+
+	cl.modelInfo = cl.models.Lookup(cl.model)
+	cl.stats.CostKnown = cl.modelInfo.PromptPrice > 0 || cl.modelInfo.CompletionPrice > 0
+
 	return cl
 }
@@ -22,14 +22,28 @@
 
 package gpt
 
-import "github.com/sashabaranov/go-openai"
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rammstein4o/git-gpt/cache"
+	"github.com/sashabaranov/go-openai"
+)
 
 type Option func(*client)
 
 func WithOpenAI(token, model string) Option {
 	return func(c *client) {
 		c.model = model
-		c.client = openai.NewClient(token)
+		c.newBackend = func(httpClient *http.Client) Backend {
+			config := openai.DefaultConfig(token)
+			config.HTTPClient = httpClient
+
+			return &openAIBackend{
+				client: openai.NewClientWithConfig(config),
+			}
+		}
 	}
 }
 
@@ -48,7 +62,62 @@ func WithAzureOpenAI(token, endpoint, model, alias string) Option {
 
 	return func(c *client) {
 		c.model = model
-		c.client = openai.NewClientWithConfig(config)
+		c.newBackend = func(httpClient *http.Client) Backend {
+			config.HTTPClient = httpClient
+
+			return &openAIBackend{
+				client: openai.NewClientWithConfig(config),
+			}
+		}
+	}
+}
+
+// WithOllama uses a local Ollama server, an empty endpoint means DefaultOllamaEndpoint.
+func WithOllama(endpoint, model string) Option {
+	return func(c *client) {
+		c.model = model
+		c.newBackend = func(httpClient *http.Client) Backend {
+			return NewOllama(endpoint, httpClient)
+		}
+	}
+}
+
+// WithBackend uses a custom Backend, e.g. a stand-in for tests. Retries are left to the backend.
+func WithBackend(backend Backend, model string) Option {
+	return func(c *client) {
+		c.model = model
+		c.newBackend = func(_ *http.Client) Backend {
+			return backend
+		}
+	}
+}
+
+// WithMaxRetries sets how many times a request failing with a network error, 429 or 5xx is retried, 0 disables retries.
+func WithMaxRetries(maxRetries int) Option {
+	return func(c *client) {
+		c.maxRetries = maxRetries
+	}
+}
+
+// WithRequestTimeout bounds every attempt of a request, 0 disables the timeout.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(c *client) {
+		c.requestTimeout = timeout
+	}
+}
+
+// WithRetryNotify reports every retry, e.g. to tell the user why the run is waiting.
+func WithRetryNotify(notify RetryNotifyFunc) Option {
+	return func(c *client) {
+		c.retryNotify = notify
+	}
+}
+
+// WithDryRun prints every request to w together with its token estimate instead of sending it.
+// The requests are answered with placeholders, so no backend or API key is needed.
+func WithDryRun(w io.Writer) Option {
+	return func(c *client) {
+		c.dryRun = w
 	}
 }
 
@@ -58,6 +127,13 @@ func WithStream(stream bool) Option {
 	}
 }
 
+// WithStreamWriter sets where streamed tokens are rendered while they arrive, e.g. the terminal.
+func WithStreamWriter(w io.Writer) Option {
+	return func(c *client) {
+		c.streamWriter = w
+	}
+}
+
 func WithMaxTokens(maxTokens int) Option {
 	return func(c *client) {
 		c.maxTokens = maxTokens
@@ -81,6 +157,50 @@ func WithTopP(topP float32) Option {
 	}
 }
 
+// WithCache keeps the per-file summaries in the given cache, a nil cache disables caching.
+func WithCache(summaryCache *cache.Cache) Option {
+	return func(c *client) {
+		c.cache = summaryCache
+	}
+}
+
+// WithContentFingerprint sets the fingerprint of the settings that shaped the diffs and file contents given to
+// the client, e.g. the diff context and the redaction. It is part of the cache keys of the summaries.
+func WithContentFingerprint(fingerprint string) Option {
+	return func(c *client) {
+		c.fingerprint = fingerprint
+	}
+}
+
+// WithCommitStyle selects the format of the final commit message, e.g. COMMIT_STYLE_CONVENTIONAL.
+func WithCommitStyle(style string) Option {
+	return func(c *client) {
+		c.commitStyle = style
+	}
+}
+
+// WithLanguage sets the locale code of the final commit message and of the reviews, e.g. de or pt-BR.
+// The code is expected to be checked with NormalizeLanguage.
+func WithLanguage(language string) Option {
+	return func(c *client) {
+		c.language = language
+	}
+}
+
+// WithMaxCost sets the budget in USD of a run, zero disables the budget guard.
+func WithMaxCost(maxCost float64) Option {
+	return func(c *client) {
+		c.maxCost = maxCost
+	}
+}
+
+// WithModels extends the built-in model catalog, the given entries take precedence.
+func WithModels(models map[string]ModelInfo) Option {
+	return func(c *client) {
+		c.models = c.models.merge(models)
+	}
+}
+
 func WithMaxChunkSize(maxChunkSize int) Option {
 	return func(c *client) {
 		c.maxChunkSize = maxChunkSize
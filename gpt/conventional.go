@@ -0,0 +1,377 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rammstein4o/git-gpt/utils"
+)
+
+const (
+	COMMIT_STYLE_DEFAULT      = ""
+	COMMIT_STYLE_CONVENTIONAL = "conventional"
+
+	// conventionalHeaderMaxLength follows the default header-max-length rule of commitlint.
+	conventionalHeaderMaxLength = 100
+	// conventionalMaxAttempts is how many times the model is asked for a message that parses.
+	conventionalMaxAttempts = 3
+)
+
+// ConventionalTypes lists the commit types accepted in conventional mode.
+var ConventionalTypes = []string{
+	"feat",
+	"fix",
+	"docs",
+	"style",
+	"refactor",
+	"perf",
+	"test",
+	"build",
+	"ci",
+	"chore",
+	"revert",
+}
+
+var (
+	conventionalHeaderRe   = regexp.MustCompile(`^([a-zA-Z]+)(?:\(([^()\r\n]+)\))?(!)?: (\S.*)$`)
+	breakingChangeFooterRe = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGE: \S`)
+	codeFenceRe            = regexp.MustCompile("(?s)^```[a-zA-Z]*\\n(.*?)\\n?```$")
+)
+
+// PathKind classifies a changed path by its role in the project.
+type PathKind string
+
+const (
+	PATH_KIND_CODE  PathKind = "code"
+	PATH_KIND_DOCS  PathKind = "docs"
+	PATH_KIND_TEST  PathKind = "test"
+	PATH_KIND_CI    PathKind = "ci"
+	PATH_KIND_BUILD PathKind = "build"
+)
+
+var buildFiles = map[string]bool{
+	"go.mod":            true,
+	"go.sum":            true,
+	"package.json":      true,
+	"package-lock.json": true,
+	"yarn.lock":         true,
+	"pnpm-lock.yaml":    true,
+	"makefile":          true,
+	"dockerfile":        true,
+	"pyproject.toml":    true,
+	"setup.py":          true,
+	"setup.cfg":         true,
+	"pipfile":           true,
+	"pipfile.lock":      true,
+	"poetry.lock":       true,
+	"cargo.toml":        true,
+	"cargo.lock":        true,
+	"pom.xml":           true,
+	"build.gradle":      true,
+	"build.gradle.kts":  true,
+	"gemfile":           true,
+	"gemfile.lock":      true,
+	"composer.json":     true,
+	"composer.lock":     true,
+}
+
+// ClassifyPath tells whether a path holds documentation, tests, CI or build configuration, or regular code.
+func ClassifyPath(p string) PathKind {
+	lower := strings.ToLower(p)
+	base := path.Base(lower)
+	ext := path.Ext(lower)
+	dirs := strings.Split(path.Dir(lower), "/")
+
+	hasDir := func(names ...string) bool {
+		for _, dir := range dirs {
+			for _, name := range names {
+				if dir == name {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(lower, ".github/workflows/"),
+		strings.HasPrefix(lower, ".circleci/"),
+		base == ".gitlab-ci.yml",
+		base == ".travis.yml",
+		base == "jenkinsfile",
+		base == "azure-pipelines.yml":
+		return PATH_KIND_CI
+	case strings.HasSuffix(base, "_test.go"),
+		strings.HasPrefix(base, "test_") && ext == ".py",
+		strings.HasSuffix(base, "_test.py"),
+		strings.Contains(base, ".test."),
+		strings.Contains(base, ".spec."),
+		hasDir("test", "tests", "__tests__", "testdata", "spec"):
+		return PATH_KIND_TEST
+	case ext == ".md", ext == ".rst", ext == ".adoc",
+		strings.HasPrefix(base, "readme"),
+		strings.HasPrefix(base, "changelog"),
+		strings.HasPrefix(base, "license"),
+		hasDir("docs", "doc"):
+		return PATH_KIND_DOCS
+	case buildFiles[base],
+		strings.HasPrefix(base, "requirements") && ext == ".txt",
+		strings.HasSuffix(base, ".gemspec"):
+		return PATH_KIND_BUILD
+	}
+
+	return PATH_KIND_CODE
+}
+
+// InferCommitType returns the conventional type implied by the changed paths alone,
+// e.g. "docs" when only documentation changed. It returns an empty string when the model has to decide.
+func InferCommitType(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+
+	kind := ClassifyPath(paths[0])
+	for _, p := range paths[1:] {
+		if ClassifyPath(p) != kind {
+			return ""
+		}
+	}
+
+	switch kind {
+	case PATH_KIND_DOCS:
+		return "docs"
+	case PATH_KIND_TEST:
+		return "test"
+	case PATH_KIND_CI:
+		return "ci"
+	case PATH_KIND_BUILD:
+		return "build"
+	}
+
+	return ""
+}
+
+// InferScope maps the changed paths to a scope. Every path is matched against the longest path prefix of scopes,
+// a scope is only returned when all paths agree on it. Without a matching entry the common top level directory is used.
+func InferScope(paths []string, scopes map[string]string) string {
+	prefixes := make([]string, 0, len(scopes))
+	for prefix := range scopes {
+		prefixes = append(prefixes, prefix)
+	}
+	// Longest prefix first, so that the most specific entry wins.
+	sort.Slice(prefixes, func(i, j int) bool {
+		return len(prefixes[i]) > len(prefixes[j])
+	})
+
+	scopeOf := func(p string) string {
+		for _, prefix := range prefixes {
+			clean := strings.TrimSuffix(prefix, "/")
+			if p == clean || strings.HasPrefix(p, clean+"/") {
+				return scopes[prefix]
+			}
+			if matched, _ := path.Match(prefix, p); matched {
+				return scopes[prefix]
+			}
+		}
+		if dir, _, found := strings.Cut(p, "/"); found {
+			return dir
+		}
+		return ""
+	}
+
+	scope := ""
+	for i, p := range paths {
+		s := scopeOf(p)
+		if s == "" || (i > 0 && s != scope) {
+			return ""
+		}
+		scope = s
+	}
+
+	return scope
+}
+
+// ConventionalCommit is a commit message parsed according to https://www.conventionalcommits.org/en/v1.0.0/
+type ConventionalCommit struct {
+	Type     string
+	Scope    string
+	Breaking bool
+	Subject  string
+	// Body holds everything after the header, including the footers.
+	Body string
+}
+
+func (cc *ConventionalCommit) Header() string {
+	header := cc.Type
+	if cc.Scope != "" {
+		header += "(" + cc.Scope + ")"
+	}
+	if cc.Breaking {
+		header += "!"
+	}
+	return header + ": " + cc.Subject
+}
+
+func (cc *ConventionalCommit) String() string {
+	if cc.Body == "" {
+		return cc.Header()
+	}
+	return cc.Header() + "\n\n" + cc.Body
+}
+
+// cleanModelAnswer removes the code fences and quotes models like to wrap their answer in.
+func cleanModelAnswer(answer string) string {
+	answer = strings.TrimSpace(answer)
+	if m := codeFenceRe.FindStringSubmatch(answer); m != nil {
+		answer = strings.TrimSpace(m[1])
+	}
+	return strings.TrimSpace(strings.Trim(answer, "\"`"))
+}
+
+// ParseConventionalCommit parses and validates a conventional commit message.
+// A BREAKING CHANGE footer without the `!` marker is normalized by adding the marker.
+func ParseConventionalCommit(msg string) (*ConventionalCommit, error) {
+	msg = cleanModelAnswer(msg)
+	if msg == "" {
+		return nil, errors.New("the commit message is empty")
+	}
+
+	header, rest, _ := strings.Cut(msg, "\n")
+	header = strings.TrimSpace(header)
+
+	m := conventionalHeaderRe.FindStringSubmatch(header)
+	if m == nil {
+		return nil, fmt.Errorf("the header %q does not match `type(scope)!: subject`", header)
+	}
+
+	cc := &ConventionalCommit{
+		Type:     strings.ToLower(m[1]),
+		Scope:    strings.TrimSpace(m[2]),
+		Breaking: m[3] == "!",
+		Subject:  strings.TrimSpace(m[4]),
+	}
+
+	if !isConventionalType(cc.Type) {
+		return nil, fmt.Errorf("unknown type %q, use one of %s", cc.Type, strings.Join(ConventionalTypes, ", "))
+	}
+
+	if len(header) > conventionalHeaderMaxLength {
+		return nil, fmt.Errorf("the header is %d characters long, the maximum is %d", len(header), conventionalHeaderMaxLength)
+	}
+
+	if rest != "" {
+		if strings.TrimSpace(strings.SplitN(rest, "\n", 2)[0]) != "" {
+			return nil, errors.New("the header must be followed by a blank line")
+		}
+		cc.Body = strings.TrimSpace(rest)
+	}
+
+	hasFooter := breakingChangeFooterRe.MatchString(cc.Body)
+	switch {
+	case cc.Breaking && !hasFooter:
+		return nil, errors.New("a breaking change marked with `!` needs a `BREAKING CHANGE: <description>` footer")
+	case hasFooter:
+		cc.Breaking = true
+	}
+
+	return cc, nil
+}
+
+func isConventionalType(t string) bool {
+	for _, ct := range ConventionalTypes {
+		if ct == t {
+			return true
+		}
+	}
+	return false
+}
+
+// finalizeConventionalCommitMsg asks for a conventional commit message and re-prompts with the validation error
+// until the answer parses or the attempts are used up.
+func (c *client) finalizeConventionalCommitMsg(ctx context.Context, prompt string, hints CommitHints, allowStream bool, systemMessages ...string) (string, error) {
+	conventionalMsg, err := utils.GetTemplateByString(
+		FinalizeConventionalMsgTemplate,
+		utils.Data{
+			"types": strings.Join(ConventionalTypes, ", "),
+			"type":  hints.Type,
+			"scope": hints.Scope,
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	systemMessages = append(systemMessages, conventionalMsg)
+
+	// Only the feedback on the latest attempt is sent along, older attempts would just cost tokens.
+	retryMsg := ""
+	var lastErr error
+	for attempt := 0; attempt < conventionalMaxAttempts; attempt++ {
+		msgs := systemMessages
+		if retryMsg != "" {
+			msgs = append(msgs[:len(msgs):len(msgs)], retryMsg)
+		}
+
+		answer, err := c.completeFinal(ctx, prompt, allowStream, msgs...)
+		if err != nil {
+			return "", err
+		}
+
+		cc, err := ParseConventionalCommit(answer)
+		if err == nil {
+			// The types and scopes inferred from the paths are more reliable than the guess of the model.
+			if hints.Type != "" {
+				cc.Type = hints.Type
+			}
+			if hints.Scope != "" {
+				cc.Scope = hints.Scope
+			}
+
+			// A longer type or scope can push the header over the limit, so the result is validated again.
+			answer = cc.String()
+			if _, err = ParseConventionalCommit(answer); err == nil {
+				return answer, nil
+			}
+		}
+		lastErr = err
+
+		retryMsg, err = utils.GetTemplateByString(
+			ConventionalRetryTemplate,
+			utils.Data{
+				"error":  lastErr.Error(),
+				"answer": answer,
+			},
+		)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("no valid conventional commit message after %d attempts: %w", conventionalMaxAttempts, lastErr)
+}
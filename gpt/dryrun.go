@@ -0,0 +1,87 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// dryRunCommitMsg is the placeholder commit message of a dry run. It is a valid conventional commit message,
+// so the conventional mode does not retry.
+const dryRunCommitMsg = "chore: dry run, no request was sent"
+
+// dryRunCompletion prints the request instead of sending it and answers with placeholders that are passed on to
+// the next stages. The usage is the estimated prompt and the largest possible answers, so the stats of a dry run
+// add up to the worst case.
+func (c *client) dryRunCompletion(stage string, req openai.ChatCompletionRequest, promptTokens int) openai.ChatCompletionResponse {
+	completionTokens := req.N * c.maxCompletionTokens()
+
+	c.dryRunMu.Lock()
+	defer c.dryRunMu.Unlock()
+
+	c.dryRunRequests++
+	w := c.dryRun
+
+	fmt.Fprintf(w, "================Request %d: %s====================\n", c.dryRunRequests, stage)
+	for _, msg := range req.Messages {
+		fmt.Fprintf(w, "--- %s (~%d tokens) ---\n", msg.Role, countTokens(c.modelInfo, msg))
+		io.WriteString(w, msg.Content+"\n")
+	}
+	fmt.Fprintf(
+		w,
+		"--- %d prompt tokens, %d answer(s) of up to %d tokens each ---\n\n",
+		promptTokens,
+		req.N,
+		c.maxCompletionTokens(),
+	)
+
+	answer := fmt.Sprintf("(dry run, the answer of the %s request)", stage)
+	if stage == STAGE_FINALIZE {
+		answer = dryRunCommitMsg
+	}
+
+	choices := make([]openai.ChatCompletionChoice, req.N)
+	for i := range choices {
+		choices[i] = openai.ChatCompletionChoice{
+			Index: i,
+			Message: openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: answer,
+			},
+			FinishReason: openai.FinishReasonStop,
+		}
+	}
+
+	return openai.ChatCompletionResponse{
+		Model:   req.Model,
+		Choices: choices,
+		Usage: openai.Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		},
+	}
+}
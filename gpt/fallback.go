@@ -0,0 +1,161 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/rammstein4o/git-gpt/git"
+)
+
+// FallbackNotifyFunc is called once when the primary generator failed and the fallback takes over.
+type FallbackNotifyFunc func(err error)
+
+// Ensure, that fallback does implement Gpt.
+var _ Gpt = &fallback{}
+
+// fallback answers with the secondary generator when the primary one fails, e.g. the offline heuristic when the
+// provider is unreachable. Once the primary generator failed, the rest of the run goes to the secondary one, so a dead
+// provider does not delay every request. Interruptions and an exceeded budget are not failures of the provider and
+// are returned as they are.
+type fallback struct {
+	primary   Gpt
+	secondary Gpt
+	notify    FallbackNotifyFunc
+
+	mu     sync.Mutex
+	failed bool
+}
+
+// NewWithFallback wraps the primary generator so that the secondary one answers when it fails.
+func NewWithFallback(primary, secondary Gpt, notify FallbackNotifyFunc) Gpt {
+	return &fallback{
+		primary:   primary,
+		secondary: secondary,
+		notify:    notify,
+	}
+}
+
+// usePrimary tells whether the primary generator is still in use.
+func (f *fallback) usePrimary() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return !f.failed
+}
+
+// switchOver decides whether the error of the primary generator is a reason to fall back and records the switch.
+func (f *fallback) switchOver(ctx context.Context, err error) bool {
+	var budgetErr *BudgetExceededError
+	if errors.Is(ctx.Err(), context.Canceled) || errors.As(err, &budgetErr) {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.failed {
+		f.failed = true
+		if f.notify != nil {
+			f.notify(err)
+		}
+	}
+	return true
+}
+
+// try calls the primary generator and, when it fails, the secondary one. The error of the primary generator is
+// returned when the secondary one fails too.
+func try[T any](ctx context.Context, f *fallback, call func(Gpt) (T, error)) (T, error) {
+	if f.usePrimary() {
+		result, err := call(f.primary)
+		if err == nil || !f.switchOver(ctx, err) {
+			return result, err
+		}
+
+		if result, fallbackErr := call(f.secondary); fallbackErr == nil {
+			return result, nil
+		}
+		return result, err
+	}
+
+	return call(f.secondary)
+}
+
+func (f *fallback) SummarizeFile(ctx context.Context, change git.StagedChange, fileContent string) (string, error) {
+	return try(ctx, f, func(g Gpt) (string, error) {
+		return g.SummarizeFile(ctx, change, fileContent)
+	})
+}
+
+func (f *fallback) SummarizeDiff(ctx context.Context, change git.StagedChange, diff string) (string, error) {
+	return try(ctx, f, func(g Gpt) (string, error) {
+		return g.SummarizeDiff(ctx, change, diff)
+	})
+}
+
+func (f *fallback) SummarizeChanges(ctx context.Context, changes []string) (string, error) {
+	return try(ctx, f, func(g Gpt) (string, error) {
+		return g.SummarizeChanges(ctx, changes)
+	})
+}
+
+func (f *fallback) FinalizeCommitMsg(ctx context.Context, prompt string, hints CommitHints) (string, error) {
+	return try(ctx, f, func(g Gpt) (string, error) {
+		return g.FinalizeCommitMsg(ctx, prompt, hints)
+	})
+}
+
+func (f *fallback) FinalizeCommitMsgCandidates(ctx context.Context, prompt string, hints CommitHints, n int) ([]string, error) {
+	return try(ctx, f, func(g Gpt) ([]string, error) {
+		return g.FinalizeCommitMsgCandidates(ctx, prompt, hints, n)
+	})
+}
+
+// ReviewDiff only asks the primary generator, a review without a model would be of no use.
+func (f *fallback) ReviewDiff(ctx context.Context, fileName, diff string) ([]ReviewFinding, error) {
+	return f.primary.ReviewDiff(ctx, fileName, diff)
+}
+
+func (f *fallback) DescribePullRequest(ctx context.Context, commitLog string, changes []string) (PullRequest, error) {
+	return try(ctx, f, func(g Gpt) (PullRequest, error) {
+		return g.DescribePullRequest(ctx, commitLog, changes)
+	})
+}
+
+func (f *fallback) ClassifyCommits(ctx context.Context, commits []git.CommitInfo) ([]ChangelogEntry, error) {
+	return try(ctx, f, func(g Gpt) ([]ChangelogEntry, error) {
+		return g.ClassifyCommits(ctx, commits)
+	})
+}
+
+// ListModels only asks the primary generator, the models of the fallback are of no interest.
+func (f *fallback) ListModels(ctx context.Context) ([]string, error) {
+	return f.primary.ListModels(ctx)
+}
+
+// GetStats returns the usage of the primary generator, the fallback does not use any tokens.
+func (f *fallback) GetStats(ctx context.Context) *Stats {
+	return f.primary.GetStats(ctx)
+}
@@ -0,0 +1,365 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/rammstein4o/git-gpt/git"
+)
+
+// heuristicMaxBodyFiles is the number of files listed in the body of a heuristic commit message.
+const heuristicMaxBodyFiles = 20
+
+// dependencyFiles are the manifests and lock files whose changes alone make a dependency bump.
+var dependencyFiles = map[string]bool{
+	"go.mod":            true,
+	"go.sum":            true,
+	"package.json":      true,
+	"package-lock.json": true,
+	"yarn.lock":         true,
+	"pnpm-lock.yaml":    true,
+	"pyproject.toml":    true,
+	"pipfile":           true,
+	"pipfile.lock":      true,
+	"poetry.lock":       true,
+	"cargo.toml":        true,
+	"cargo.lock":        true,
+	"gemfile":           true,
+	"gemfile.lock":      true,
+	"composer.json":     true,
+	"composer.lock":     true,
+}
+
+var (
+	trailerRe         = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*: \S`)
+	fixSubjectRe      = regexp.MustCompile(`(?i)\b(fix(e[sd])?|bug|hotfix|resolve[sd]?|patch(e[sd])?)\b`)
+	featureSubjectRe  = regexp.MustCompile(`(?i)^(add(s|ed)?|implement(s|ed)?|introduce[sd]?|support(s|ed)?|new)\b`)
+	breakingSubjectRe = regexp.MustCompile(`(?i)\bbreaking\b`)
+)
+
+// Ensure, that heuristic does implement Gpt.
+var _ Gpt = &heuristic{}
+
+// heuristic writes commit messages without any model, from the kinds, the paths and the line counts of the changes.
+// It recognizes changes that only touch documentation, tests, CI or dependencies, and pure renames.
+type heuristic struct {
+	commitStyle string
+	stats       *Stats
+}
+
+// NewHeuristic creates the offline generator, commitStyle is the format of the commit messages,
+// e.g. COMMIT_STYLE_CONVENTIONAL.
+func NewHeuristic(commitStyle string) Gpt {
+	return &heuristic{
+		commitStyle: commitStyle,
+		stats:       &Stats{},
+	}
+}
+
+// CheckHeuristicOptions reports the options the offline generator cannot honour, instead of ignoring them:
+// a dry run, since no prompt is ever written, and a language other than English.
+func CheckHeuristicOptions(opts ...Option) error {
+	probe := &client{}
+	for _, fn := range opts {
+		fn(probe)
+	}
+
+	if probe.dryRun != nil {
+		return errors.New("a dry run shows the prompts sent to a model, the heuristic mode sends none")
+	}
+	if probe.language != "" && probe.language != DefaultLanguage {
+		return fmt.Errorf("the heuristic mode writes English only, %s needs a model", Languages[probe.language])
+	}
+
+	return nil
+}
+
+func (h *heuristic) SummarizeFile(ctx context.Context, change git.StagedChange, fileContent string) (string, error) {
+	h.stats.addFile()
+	return DescribeChange(change), nil
+}
+
+func (h *heuristic) SummarizeDiff(ctx context.Context, change git.StagedChange, diff string) (string, error) {
+	h.stats.addFile()
+	return DescribeChange(change), nil
+}
+
+func (h *heuristic) SummarizeChanges(ctx context.Context, changes []string) (string, error) {
+	return strings.TrimSpace(strings.Join(changes, "\n")), nil
+}
+
+func (h *heuristic) FinalizeCommitMsg(ctx context.Context, prompt string, hints CommitHints) (string, error) {
+	return heuristicCommitMsg(hints, h.commitStyle), nil
+}
+
+// FinalizeCommitMsgCandidates returns a single candidate, the heuristic has no alternatives to offer.
+func (h *heuristic) FinalizeCommitMsgCandidates(ctx context.Context, prompt string, hints CommitHints, n int) ([]string, error) {
+	return []string{heuristicCommitMsg(hints, h.commitStyle)}, nil
+}
+
+func (h *heuristic) ReviewDiff(ctx context.Context, fileName, diff string) ([]ReviewFinding, error) {
+	return nil, errors.New("reviews need a model, the heuristic mode can not review changes")
+}
+
+// DescribePullRequest lists the commits as the summary and the changed files as the changes.
+func (h *heuristic) DescribePullRequest(ctx context.Context, commitLog string, changes []string) (PullRequest, error) {
+	lines := make([]string, 0, len(changes))
+	for _, change := range changes {
+		lines = append(lines, "- "+strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(change), ":")))
+	}
+
+	return PullRequest{
+		Summary: strings.TrimSpace(commitLog),
+		Changes: strings.Join(lines, "\n"),
+	}, nil
+}
+
+// ClassifyCommits sorts the commits by keywords of their subjects.
+func (h *heuristic) ClassifyCommits(ctx context.Context, commits []git.CommitInfo) ([]ChangelogEntry, error) {
+	entries := make([]ChangelogEntry, 0, len(commits))
+	for _, commit := range commits {
+		subject := commit.Subject()
+
+		kind := CHANGELOG_CHORE
+		switch {
+		case breakingSubjectRe.MatchString(commit.Message):
+			kind = CHANGELOG_BREAKING
+		case fixSubjectRe.MatchString(subject):
+			kind = CHANGELOG_FIX
+		case featureSubjectRe.MatchString(subject):
+			kind = CHANGELOG_FEATURE
+		}
+
+		entries = append(entries, ChangelogEntry{
+			Hash:        commit.Hash,
+			Kind:        kind,
+			Description: subject,
+		})
+	}
+	return entries, nil
+}
+
+func (h *heuristic) ListModels(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func (h *heuristic) GetStats(ctx context.Context) *Stats {
+	return h.stats
+}
+
+// heuristicCommitMsg builds the commit message: a header naming what changed, a body listing the changed files
+// with their line counts and the trailers of the previous message, if any.
+func heuristicCommitMsg(hints CommitHints, commitStyle string) string {
+	commitType, scope, subject := heuristicHeader(hints)
+
+	header := strings.ToUpper(subject[:1]) + subject[1:]
+	if commitStyle == COMMIT_STYLE_CONVENTIONAL {
+		cc := ConventionalCommit{Type: commitType, Scope: scope, Subject: subject}
+		header = cc.Header()
+	}
+
+	parts := []string{header}
+	if body := heuristicBody(hints.NumStat); body != "" {
+		parts = append(parts, body)
+	}
+	if trailers := messageTrailers(hints.PreviousMessage); trailers != "" {
+		parts = append(parts, trailers)
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
+// heuristicHeader returns the conventional type, the scope and the subject describing the changes.
+func heuristicHeader(hints CommitHints) (string, string, string) {
+	changes := hints.Changes
+	deps := dependencyPaths(hints)
+	if len(changes) == 0 {
+		if len(deps) > 0 {
+			return "build", "deps", "update dependencies in " + joinNames(deps)
+		}
+		return "chore", hints.Scope, "update files"
+	}
+
+	paths := make([]string, 0, len(changes))
+	allMoves, allAdded, allDeleted := true, true, true
+	for _, change := range changes {
+		paths = append(paths, change.Path)
+		if !change.IsMove() || change.Score < 100 {
+			allMoves = false
+		}
+		if change.Kind != git.OPERATION_ADD {
+			allAdded = false
+		}
+		if change.Kind != git.OPERATION_DEL {
+			allDeleted = false
+		}
+	}
+
+	verb := "update"
+	switch {
+	case allAdded:
+		verb = "add"
+	case allDeleted:
+		verb = "remove"
+	}
+
+	switch {
+	case allMoves:
+		if len(changes) == 1 {
+			return "refactor", hints.Scope, fmt.Sprintf("rename %s to %s", changes[0].OldPath, changes[0].Path)
+		}
+		if dir := commonDir(paths); dir != "" {
+			return "refactor", hints.Scope, fmt.Sprintf("move %d files to %s", len(changes), dir)
+		}
+		return "refactor", hints.Scope, fmt.Sprintf("move %d files", len(changes))
+	case len(deps) > 0:
+		return "build", "deps", "update dependencies in " + joinNames(deps)
+	}
+
+	switch hints.Type {
+	case "docs":
+		if len(changes) > 3 {
+			return hints.Type, hints.Scope, verb + " documentation"
+		}
+		return hints.Type, hints.Scope, verb + " " + joinNames(paths)
+	case "test":
+		if len(changes) > 3 {
+			return hints.Type, hints.Scope, verb + " tests"
+		}
+		return hints.Type, hints.Scope, verb + " " + joinNames(paths)
+	case "ci":
+		return hints.Type, hints.Scope, verb + " CI configuration"
+	case "build":
+		return hints.Type, hints.Scope, verb + " build configuration"
+	}
+
+	commitType := "chore"
+	if allAdded {
+		commitType = "feat"
+	}
+
+	if len(changes) > 3 {
+		if dir := commonDir(paths); dir != "" {
+			return commitType, hints.Scope, fmt.Sprintf("%s %d files in %s", verb, len(changes), dir)
+		}
+		return commitType, hints.Scope, fmt.Sprintf("%s %d files", verb, len(changes))
+	}
+
+	return commitType, hints.Scope, verb + " " + joinNames(paths)
+}
+
+// dependencyPaths returns the paths of the staged files if all of them are dependency manifests or lock files, nil
+// otherwise. The lock files are left out of the staged changes by default, only the line counts list them.
+func dependencyPaths(hints CommitHints) []string {
+	paths := make([]string, 0, len(hints.Changes)+len(hints.NumStat))
+	for _, change := range hints.Changes {
+		paths = append(paths, change.Path)
+	}
+	for _, stat := range hints.NumStat {
+		paths = append(paths, stat.Path)
+	}
+
+	for _, p := range paths {
+		if !dependencyFiles[strings.ToLower(path.Base(p))] {
+			return nil
+		}
+	}
+	return paths
+}
+
+// heuristicBody lists the changed files with their added and deleted lines.
+func heuristicBody(numStat []git.FileStat) string {
+	lines := make([]string, 0, len(numStat))
+	for i, stat := range numStat {
+		if i == heuristicMaxBodyFiles {
+			lines = append(lines, fmt.Sprintf("- and %d more files", len(numStat)-i))
+			break
+		}
+
+		name := stat.Path
+		if stat.OldPath != "" {
+			name = stat.OldPath + " -> " + stat.Path
+		}
+
+		if stat.Binary {
+			lines = append(lines, fmt.Sprintf("- %s (binary)", name))
+		} else {
+			lines = append(lines, fmt.Sprintf("- %s (+%d -%d)", name, stat.Added, stat.Deleted))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// messageTrailers returns the trailers of the message, e.g. "Refs: PROJ-12", found in its last paragraph.
+func messageTrailers(msg string) string {
+	paragraphs := strings.Split(strings.TrimSpace(msg), "\n\n")
+	if len(paragraphs) < 2 {
+		return ""
+	}
+
+	last := strings.TrimSpace(paragraphs[len(paragraphs)-1])
+	for _, line := range strings.Split(last, "\n") {
+		if !trailerRe.MatchString(line) {
+			return ""
+		}
+	}
+	return last
+}
+
+// joinNames lists the base names of the paths, e.g. "a.go, b.go and c.go".
+func joinNames(paths []string) string {
+	names := make([]string, 0, len(paths))
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		name := path.Base(p)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// commonDir returns the deepest directory containing all paths, or an empty string for the root.
+func commonDir(paths []string) string {
+	dir := path.Dir(paths[0])
+	for _, p := range paths[1:] {
+		for dir != "." && dir != "/" && !strings.HasPrefix(p, dir+"/") {
+			dir = path.Dir(dir)
+		}
+	}
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return dir
+}
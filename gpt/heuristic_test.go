@@ -0,0 +1,110 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"io"
+	"testing"
+
+	"github.com/rammstein4o/git-gpt/git"
+)
+
+func TestCheckHeuristicOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"english", []Option{WithLanguage(DefaultLanguage), WithStream(true)}, false},
+		{"other language", []Option{WithLanguage("de")}, true},
+		{"dry run", []Option{WithDryRun(io.Discard)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckHeuristicOptions(tt.opts...); (err != nil) != tt.wantErr {
+				t.Errorf("CheckHeuristicOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHeuristicHeaderDependencies(t *testing.T) {
+	modified := func(paths ...string) []git.StagedChange {
+		changes := make([]git.StagedChange, 0, len(paths))
+		for _, p := range paths {
+			changes = append(changes, git.StagedChange{Kind: git.OPERATION_MOD, Path: p})
+		}
+		return changes
+	}
+	counted := func(paths ...string) []git.FileStat {
+		stats := make([]git.FileStat, 0, len(paths))
+		for _, p := range paths {
+			stats = append(stats, git.FileStat{Path: p, Added: 1, Deleted: 1})
+		}
+		return stats
+	}
+
+	// The staged changes leave out the lock files by default, the line counts keep them.
+	tests := []struct {
+		name        string
+		hints       CommitHints
+		wantType    string
+		wantSubject string
+	}{
+		{
+			name:        "manifest and lock file",
+			hints:       CommitHints{Changes: modified("go.mod"), NumStat: counted("go.mod", "go.sum")},
+			wantType:    "build",
+			wantSubject: "update dependencies in go.mod and go.sum",
+		},
+		{
+			name:        "lock files only",
+			hints:       CommitHints{NumStat: counted("web/package-lock.json", "Cargo.lock")},
+			wantType:    "build",
+			wantSubject: "update dependencies in package-lock.json and Cargo.lock",
+		},
+		{
+			name:        "lock file next to code",
+			hints:       CommitHints{Changes: modified("main.go"), NumStat: counted("main.go", "go.sum")},
+			wantType:    "chore",
+			wantSubject: "update main.go",
+		},
+		{
+			name:        "nothing staged",
+			hints:       CommitHints{},
+			wantType:    "chore",
+			wantSubject: "update files",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commitType, _, subject := heuristicHeader(tt.hints)
+			if commitType != tt.wantType || subject != tt.wantSubject {
+				t.Errorf("heuristicHeader() = %q, %q, want %q, %q", commitType, subject, tt.wantType, tt.wantSubject)
+			}
+		})
+	}
+}
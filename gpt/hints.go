@@ -0,0 +1,41 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import "github.com/rammstein4o/git-gpt/git"
+
+// CommitHints carries what is known about the commit besides the summarized changes.
+type CommitHints struct {
+	// Type is the conventional commit type inferred from the changed paths, if any.
+	Type string
+	// Scope is the conventional commit scope inferred from the changed paths, if any.
+	Scope string
+	// Instruction is an extra request of the user, e.g. "mention the migration".
+	Instruction string
+	// PreviousMessage is the message of the commit being amended, if any.
+	PreviousMessage string
+	// Changes are the staged changes the message describes.
+	Changes []git.StagedChange
+	// NumStat holds the added and deleted lines of every staged file.
+	NumStat []git.FileStat
+}
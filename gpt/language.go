@@ -0,0 +1,140 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rammstein4o/git-gpt/utils"
+)
+
+// DefaultLanguage is the language of the generated texts unless another one is configured.
+const DefaultLanguage = "en"
+
+// Languages maps the supported locale codes to the name of the language given to the model.
+var Languages = map[string]string{
+	"ar":    "Arabic",
+	"bg":    "Bulgarian",
+	"ca":    "Catalan",
+	"cs":    "Czech",
+	"da":    "Danish",
+	"de":    "German",
+	"el":    "Greek",
+	"en":    "English",
+	"en-GB": "British English",
+	"en-US": "American English",
+	"es":    "Spanish",
+	"et":    "Estonian",
+	"fa":    "Persian",
+	"fi":    "Finnish",
+	"fr":    "French",
+	"he":    "Hebrew",
+	"hi":    "Hindi",
+	"hr":    "Croatian",
+	"hu":    "Hungarian",
+	"id":    "Indonesian",
+	"it":    "Italian",
+	"ja":    "Japanese",
+	"ko":    "Korean",
+	"lt":    "Lithuanian",
+	"lv":    "Latvian",
+	"nb":    "Norwegian Bokmål",
+	"nl":    "Dutch",
+	"pl":    "Polish",
+	"pt":    "Portuguese",
+	"pt-BR": "Brazilian Portuguese",
+	"pt-PT": "European Portuguese",
+	"ro":    "Romanian",
+	"ru":    "Russian",
+	"sk":    "Slovak",
+	"sl":    "Slovenian",
+	"sr":    "Serbian",
+	"sv":    "Swedish",
+	"th":    "Thai",
+	"tr":    "Turkish",
+	"uk":    "Ukrainian",
+	"vi":    "Vietnamese",
+	"zh":    "Chinese",
+	"zh-CN": "Simplified Chinese",
+	"zh-TW": "Traditional Chinese",
+}
+
+// NormalizeLanguage validates a locale code and returns it in its canonical form, e.g. pt_br becomes pt-BR.
+// An empty code means the DefaultLanguage.
+func NormalizeLanguage(code string) (string, error) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), "_", "-")
+	if code == "" {
+		return DefaultLanguage, nil
+	}
+
+	for known := range Languages {
+		if strings.EqualFold(known, code) {
+			return known, nil
+		}
+	}
+
+	codes := make([]string, 0, len(Languages))
+	for known := range Languages {
+		codes = append(codes, known)
+	}
+	sort.Strings(codes)
+
+	return "", fmt.Errorf("unsupported language %q, use one of %s", code, strings.Join(codes, ", "))
+}
+
+// languageData returns the name and the locale code of the configured language,
+// so templates can mention it, e.g. {{ .language }} ({{ .code }}).
+func (c *client) languageData() utils.Data {
+	code := c.language
+	if code == "" {
+		code = DefaultLanguage
+	}
+
+	return utils.Data{
+		"language": Languages[code],
+		"code":     code,
+	}
+}
+
+// languageMessage returns the system message asking for answers in the configured language.
+// Nothing is added for English, the language every prompt is written in.
+func (c *client) languageMessage() (string, error) {
+	if c.language == "" || c.language == DefaultLanguage {
+		return "", nil
+	}
+
+	name, ok := Languages[c.language]
+	if !ok {
+		return "", fmt.Errorf("unsupported language %q", c.language)
+	}
+
+	return utils.GetTemplateByString(
+		OutputLanguageTemplate,
+		utils.Data{
+			"language": name,
+			"code":     c.language,
+		},
+	)
+}
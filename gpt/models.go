@@ -0,0 +1,188 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"strings"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// ModelInfo describes the limits, the tokenizer and the pricing of a model.
+// Prices are in USD per 1000 tokens, a zero price means the cost is unknown or free.
+// TokensPerMessage and TokensPerName are pointers, since zero is a valid count that must not be replaced by the fallback.
+type ModelInfo struct {
+	ContextWindow    int     `mapstructure:"context_window"`
+	MaxOutputTokens  int     `mapstructure:"max_output_tokens"`
+	Encoding         string  `mapstructure:"encoding"`
+	TokensPerMessage *int    `mapstructure:"tokens_per_message"`
+	TokensPerName    *int    `mapstructure:"tokens_per_name"`
+	PromptPrice      float64 `mapstructure:"prompt_price"`
+	CompletionPrice  float64 `mapstructure:"completion_price"`
+}
+
+// tokenCount returns a pointer to the count, for the optional counts of ModelInfo.
+func tokenCount(n int) *int {
+	return &n
+}
+
+// ModelCatalog maps a model name, or a prefix of model names, to its description.
+type ModelCatalog map[string]ModelInfo
+
+// fallbackModel is used for models missing from the catalog.
+// The context window is small enough for every chat model still in use.
+var fallbackModel = ModelInfo{
+	ContextWindow:    8192,
+	Encoding:         tiktoken.MODEL_CL100K_BASE,
+	TokensPerMessage: tokenCount(3),
+	TokensPerName:    tokenCount(1),
+}
+
+// DefaultModels holds the built-in catalog. Entries also match dated snapshots, e.g. gpt-4o matches gpt-4o-2024-08-06.
+var DefaultModels = ModelCatalog{
+	"gpt-3.5-turbo": {
+		ContextWindow:   16385,
+		MaxOutputTokens: 4096,
+		PromptPrice:     0.0005,
+		CompletionPrice: 0.0015,
+	},
+	"gpt-3.5-turbo-0301": {
+		ContextWindow:    4096,
+		MaxOutputTokens:  4096,
+		TokensPerMessage: tokenCount(4),  // every message follows <|start|>{role/name}\n{content}<|end|>\n
+		TokensPerName:    tokenCount(-1), // if there's a name, the role is omitted
+		PromptPrice:      0.0015,
+		CompletionPrice:  0.002,
+	},
+	"gpt-3.5-turbo-0613": {
+		ContextWindow:   4096,
+		MaxOutputTokens: 4096,
+		PromptPrice:     0.0015,
+		CompletionPrice: 0.002,
+	},
+	"gpt-3.5-turbo-16k": {
+		ContextWindow:   16385,
+		MaxOutputTokens: 4096,
+		PromptPrice:     0.003,
+		CompletionPrice: 0.004,
+	},
+	"gpt-3.5-turbo-instruct": {
+		ContextWindow:   4096,
+		MaxOutputTokens: 4096,
+		PromptPrice:     0.0015,
+		CompletionPrice: 0.002,
+	},
+	"gpt-4": {
+		ContextWindow:   8192,
+		MaxOutputTokens: 8192,
+		PromptPrice:     0.03,
+		CompletionPrice: 0.06,
+	},
+	"gpt-4-32k": {
+		ContextWindow:   32768,
+		MaxOutputTokens: 32768,
+		PromptPrice:     0.06,
+		CompletionPrice: 0.12,
+	},
+	"gpt-4-turbo": {
+		ContextWindow:   128000,
+		MaxOutputTokens: 4096,
+		PromptPrice:     0.01,
+		CompletionPrice: 0.03,
+	},
+	"gpt-4-1106-preview": {
+		ContextWindow:   128000,
+		MaxOutputTokens: 4096,
+		PromptPrice:     0.01,
+		CompletionPrice: 0.03,
+	},
+	"gpt-4-0125-preview": {
+		ContextWindow:   128000,
+		MaxOutputTokens: 4096,
+		PromptPrice:     0.01,
+		CompletionPrice: 0.03,
+	},
+	// o200k_base is not bundled with the tokenizer, cl100k_base is a close estimate.
+	"gpt-4o": {
+		ContextWindow:   128000,
+		MaxOutputTokens: 16384,
+		PromptPrice:     0.0025,
+		CompletionPrice: 0.01,
+	},
+	"gpt-4o-mini": {
+		ContextWindow:   128000,
+		MaxOutputTokens: 16384,
+		PromptPrice:     0.00015,
+		CompletionPrice: 0.0006,
+	},
+}
+
+// Lookup returns the description of the model: an exact match first, then the longest matching prefix,
+// and finally the fallback. Fields left empty are filled in from the fallback.
+// Names are compared case-insensitively, the configuration lowercases the keys of the models section.
+func (mc ModelCatalog) Lookup(model string) ModelInfo {
+	model = strings.ToLower(model)
+
+	info, ok := ModelInfo{}, false
+	prefix := ""
+	for name, candidate := range mc {
+		name = strings.ToLower(name)
+		if name == model {
+			info, ok = candidate, true
+			break
+		}
+		if strings.HasPrefix(model, name+"-") && len(name) > len(prefix) {
+			prefix, info, ok = name, candidate, true
+		}
+	}
+	if !ok {
+		info = fallbackModel
+	}
+
+	if info.ContextWindow <= 0 {
+		info.ContextWindow = fallbackModel.ContextWindow
+	}
+	if info.Encoding == "" {
+		info.Encoding = fallbackModel.Encoding
+	}
+	if info.TokensPerMessage == nil {
+		info.TokensPerMessage = fallbackModel.TokensPerMessage
+	}
+	if info.TokensPerName == nil {
+		info.TokensPerName = fallbackModel.TokensPerName
+	}
+
+	return info
+}
+
+// merge returns a copy of the catalog extended with the given entries, which take precedence.
+func (mc ModelCatalog) merge(models map[string]ModelInfo) ModelCatalog {
+	merged := make(ModelCatalog, len(mc)+len(models))
+	for name, info := range mc {
+		merged[name] = info
+	}
+	for name, info := range models {
+		merged[name] = info
+	}
+	return merged
+}
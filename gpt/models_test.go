@@ -0,0 +1,52 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import "testing"
+
+func TestLookupKeepsZeroCounts(t *testing.T) {
+	catalog := DefaultModels.merge(map[string]ModelInfo{
+		"local-model": {
+			TokensPerMessage: tokenCount(0),
+			TokensPerName:    tokenCount(0),
+		},
+		"other-model": {},
+	})
+
+	tests := []struct {
+		model       string
+		wantMessage int
+		wantName    int
+	}{
+		{"local-model", 0, 0},
+		{"other-model", *fallbackModel.TokensPerMessage, *fallbackModel.TokensPerName},
+		{"gpt-3.5-turbo-0301", 4, -1},
+	}
+
+	for _, tt := range tests {
+		info := catalog.Lookup(tt.model)
+		if *info.TokensPerMessage != tt.wantMessage || *info.TokensPerName != tt.wantName {
+			t.Errorf("Lookup(%q) counts = %d, %d, want %d, %d", tt.model, *info.TokensPerMessage, *info.TokensPerName, tt.wantMessage, tt.wantName)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const DefaultOllamaEndpoint = "http://localhost:11434"
+
+// OllamaError is returned when the Ollama server answers with a non-successful status code.
+type OllamaError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *OllamaError) Error() string {
+	return fmt.Sprintf("ollama error, status code: %d, message: %s", e.StatusCode, e.Message)
+}
+
+type ollamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ollamaOptions struct {
+	Temperature float32 `json:"temperature"`
+	TopP        float32 `json:"top_p,omitempty"`
+	NumPredict  int     `json:"num_predict,omitempty"`
+}
+
+type ollamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Options  ollamaOptions   `json:"options"`
+}
+
+type ollamaChatResponse struct {
+	Model           string        `json:"model"`
+	CreatedAt       string        `json:"created_at"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+}
+
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+// Ensure, that ollamaBackend does implement Backend.
+var _ Backend = &ollamaBackend{}
+
+// ollamaBackend talks to a local Ollama server through its native /api/chat protocol.
+type ollamaBackend struct {
+	endpoint   string
+	httpClient *http.Client
+}
+
+// NewOllama creates a Backend for the Ollama server at endpoint. A nil httpClient means http.DefaultClient.
+func NewOllama(endpoint string, httpClient *http.Client) Backend {
+	if endpoint == "" {
+		endpoint = DefaultOllamaEndpoint
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &ollamaBackend{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// send sends the request and turns a non-successful answer into an OllamaError.
+// The caller has to close the body of the returned response.
+func (b *ollamaBackend) send(ctx context.Context, method, path string, in any) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, b.endpoint+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, &errResp) != nil || errResp.Error == "" {
+			errResp.Error = strings.TrimSpace(string(data))
+		}
+		return nil, &OllamaError{
+			StatusCode: resp.StatusCode,
+			Message:    errResp.Error,
+		}
+	}
+
+	return resp, nil
+}
+
+// do sends the request and decodes a successful JSON answer into out.
+func (b *ollamaBackend) do(ctx context.Context, method, path string, in, out any) error {
+	resp, err := b.send(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// newOllamaChatRequest maps an OpenAI request to the Ollama protocol.
+func newOllamaChatRequest(req openai.ChatCompletionRequest, stream bool) ollamaChatRequest {
+	messages := make([]ollamaMessage, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		messages = append(messages, ollamaMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		})
+	}
+
+	return ollamaChatRequest{
+		Model:    req.Model,
+		Messages: messages,
+		Stream:   stream,
+		Options: ollamaOptions{
+			Temperature: req.Temperature,
+			TopP:        req.TopP,
+			NumPredict:  req.MaxTokens,
+		},
+	}
+}
+
+// toOpenAI maps the final Ollama answer to an OpenAI response with the given content.
+func (r ollamaChatResponse) toOpenAI(content string) openai.ChatCompletionResponse {
+	finishReason := openai.FinishReasonStop
+	if r.DoneReason == "length" {
+		finishReason = openai.FinishReasonLength
+	}
+
+	return openai.ChatCompletionResponse{
+		Object:  "chat.completion",
+		Model:   r.Model,
+		Choices: assembledChoices(content, finishReason),
+		Usage: openai.Usage{
+			PromptTokens:     r.PromptEvalCount,
+			CompletionTokens: r.EvalCount,
+			TotalTokens:      r.PromptEvalCount + r.EvalCount,
+		},
+	}
+}
+
+func (b *ollamaBackend) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	var resp ollamaChatResponse
+	if err := b.do(ctx, http.MethodPost, "/api/chat", newOllamaChatRequest(req, false), &resp); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+
+	return resp.toOpenAI(resp.Message.Content), nil
+}
+
+// CreateChatCompletionStream reads the newline delimited JSON objects of a streamed answer.
+// The last object has done set and carries the token counts.
+func (b *ollamaBackend) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest, onDelta func(string)) (openai.ChatCompletionResponse, error) {
+	resp, err := b.send(ctx, http.MethodPost, "/api/chat", newOllamaChatRequest(req, true))
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	last := ollamaChatResponse{Model: req.Model}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var chunk ollamaChatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return last.toOpenAI(content.String()), err
+		}
+
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			onDelta(chunk.Message.Content)
+		}
+
+		last = chunk
+		if chunk.Done {
+			break
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return last.toOpenAI(content.String()), err
+	}
+	if !last.Done {
+		return last.toOpenAI(content.String()), io.ErrUnexpectedEOF
+	}
+
+	return last.toOpenAI(content.String()), nil
+}
+
+func (b *ollamaBackend) ListModels(ctx context.Context) ([]string, error) {
+	var resp ollamaTagsResponse
+	if err := b.do(ctx, http.MethodGet, "/api/tags", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	models := make([]string, 0, len(resp.Models))
+	for _, model := range resp.Models {
+		models = append(models, model.Name)
+	}
+
+	return models, nil
+}
@@ -0,0 +1,215 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ollamaServer serves /api/chat with the handler and records the decoded chat requests.
+func ollamaServer(t *testing.T, chat func(w http.ResponseWriter, req ollamaChatRequest)) (Backend, *[]ollamaChatRequest) {
+	t.Helper()
+
+	var requests []ollamaChatRequest
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/chat", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+
+		var req ollamaChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding the request: %v", err)
+		}
+		requests = append(requests, req)
+		chat(w, req)
+	})
+	mux.HandleFunc("/api/tags", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"models":[{"name":"llama3:latest"},{"name":"qwen2.5-coder:7b"}]}`)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	// A trailing slash of the endpoint must not end up in the paths.
+	return NewOllama(server.URL+"/", nil), &requests
+}
+
+var ollamaTestRequest = openai.ChatCompletionRequest{
+	Model: "llama3",
+	Messages: []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "You write commit messages."},
+		{Role: openai.ChatMessageRoleUser, Content: "Describe the changes."},
+	},
+	Temperature: 0.4,
+	TopP:        1,
+	MaxTokens:   300,
+}
+
+func TestOllamaChat(t *testing.T) {
+	backend, requests := ollamaServer(t, func(w http.ResponseWriter, req ollamaChatRequest) {
+		_, _ = io.WriteString(w, `{"model":"llama3","message":{"role":"assistant","content":"Add the client"},"done":true,"done_reason":"length","prompt_eval_count":12,"eval_count":3}`)
+	})
+
+	resp, err := backend.CreateChatCompletion(context.Background(), ollamaTestRequest)
+	if err != nil {
+		t.Fatalf("CreateChatCompletion() error = %v", err)
+	}
+
+	if got := resp.Choices[0].Message.Content; got != "Add the client" {
+		t.Errorf("content = %q, want %q", got, "Add the client")
+	}
+	if resp.Choices[0].FinishReason != openai.FinishReasonLength {
+		t.Errorf("finish reason = %q, want %q", resp.Choices[0].FinishReason, openai.FinishReasonLength)
+	}
+	if want := (openai.Usage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15}); resp.Usage != want {
+		t.Errorf("usage = %+v, want %+v", resp.Usage, want)
+	}
+
+	want := ollamaChatRequest{
+		Model: "llama3",
+		Messages: []ollamaMessage{
+			{Role: "system", Content: "You write commit messages."},
+			{Role: "user", Content: "Describe the changes."},
+		},
+		Options: ollamaOptions{Temperature: 0.4, TopP: 1, NumPredict: 300},
+	}
+	if len(*requests) != 1 || !reflect.DeepEqual((*requests)[0], want) {
+		t.Errorf("requests = %+v, want %+v", *requests, want)
+	}
+}
+
+func TestOllamaChatStream(t *testing.T) {
+	backend, requests := ollamaServer(t, func(w http.ResponseWriter, req ollamaChatRequest) {
+		for _, line := range []string{
+			`{"model":"llama3","message":{"role":"assistant","content":"Add "},"done":false}`,
+			``,
+			`{"model":"llama3","message":{"role":"assistant","content":"the client"},"done":false}`,
+			`{"model":"llama3","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":12,"eval_count":4}`,
+		} {
+			_, _ = io.WriteString(w, line+"\n")
+			w.(http.Flusher).Flush()
+		}
+	})
+
+	var deltas []string
+	resp, err := backend.CreateChatCompletionStream(context.Background(), ollamaTestRequest, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("CreateChatCompletionStream() error = %v", err)
+	}
+
+	if want := []string{"Add ", "the client"}; !reflect.DeepEqual(deltas, want) {
+		t.Errorf("deltas = %q, want %q", deltas, want)
+	}
+	if got := resp.Choices[0].Message.Content; got != "Add the client" {
+		t.Errorf("content = %q, want %q", got, "Add the client")
+	}
+	if resp.Choices[0].FinishReason != openai.FinishReasonStop || resp.Usage.TotalTokens != 16 {
+		t.Errorf("finish reason = %q, usage = %+v", resp.Choices[0].FinishReason, resp.Usage)
+	}
+	if len(*requests) != 1 || !(*requests)[0].Stream {
+		t.Errorf("requests = %+v, want one streamed request", *requests)
+	}
+}
+
+func TestOllamaChatStreamInterrupted(t *testing.T) {
+	backend, _ := ollamaServer(t, func(w http.ResponseWriter, req ollamaChatRequest) {
+		_, _ = io.WriteString(w, `{"model":"llama3","message":{"role":"assistant","content":"Add "},"done":false}`+"\n")
+	})
+
+	resp, err := backend.CreateChatCompletionStream(context.Background(), ollamaTestRequest, func(string) {})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("CreateChatCompletionStream() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if got := resp.Choices[0].Message.Content; got != "Add " {
+		t.Errorf("content = %q, want the part received", got)
+	}
+}
+
+func TestOllamaError(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		message string
+	}{
+		{"json", `{"error":"model \"llama3\" not found, try pulling it first"}`, `model "llama3" not found, try pulling it first`},
+		{"plain text", "404 page not found\n", "404 page not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend, _ := ollamaServer(t, func(w http.ResponseWriter, req ollamaChatRequest) {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = io.WriteString(w, tt.body)
+			})
+
+			_, err := backend.CreateChatCompletion(context.Background(), ollamaTestRequest)
+
+			var ollamaErr *OllamaError
+			if !errors.As(err, &ollamaErr) {
+				t.Fatalf("CreateChatCompletion() error = %v, want an OllamaError", err)
+			}
+			if ollamaErr.StatusCode != http.StatusNotFound || ollamaErr.Message != tt.message {
+				t.Errorf("error = %+v, want status 404 and %q", ollamaErr, tt.message)
+			}
+		})
+	}
+}
+
+func TestOllamaListModels(t *testing.T) {
+	backend, _ := ollamaServer(t, nil)
+
+	models, err := backend.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels() error = %v", err)
+	}
+	if want := []string{"llama3:latest", "qwen2.5-coder:7b"}; !reflect.DeepEqual(models, want) {
+		t.Errorf("ListModels() = %q, want %q", models, want)
+	}
+}
+
+func TestOllamaUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	endpoint := server.URL
+	server.Close()
+
+	_, err := NewOllama(endpoint, nil).ListModels(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "connect") {
+		t.Errorf("ListModels() error = %v, want a connection error", err)
+	}
+}
@@ -33,12 +33,22 @@ import (
 var templatesFS embed.FS
 
 const (
-	SummarizeFileTemplate            = "summarize_file.tmpl"
-	SummarizeDiffTemplate            = "summarize_diff.tmpl"
-	PrevChunkSummaryTemplate         = "prev_chunk_summary.tmpl"
-	SummarizeChangesTemplate         = "summarize_changes.tmpl"
-	FinalizeCommitMsgTemplate        = "finalize_commit_msg.tmpl"
-	HookPrepareCommitMessageTemplate = "prepare-commit-msg.tmpl"
+	SummarizeFileTemplate     = "summarize_file.tmpl"
+	SummarizeDiffTemplate     = "summarize_diff.tmpl"
+	PrevChunkSummaryTemplate  = "prev_chunk_summary.tmpl"
+	SummarizeChangesTemplate  = "summarize_changes.tmpl"
+	FinalizeCommitMsgTemplate = "finalize_commit_msg.tmpl"
+	ReviewDiffTemplate        = "review_diff.tmpl"
+	UserInstructionTemplate   = "user_instruction.tmpl"
+	OutputLanguageTemplate    = "output_language.tmpl"
+	PreviousMessageTemplate   = "previous_message.tmpl"
+
+	SummarizePullRequestTemplate   = "summarize_pull_request.tmpl"
+	PullRequestDescriptionTemplate = "pr_description.tmpl"
+	ClassifyCommitsTemplate        = "classify_commits.tmpl"
+
+	FinalizeConventionalMsgTemplate = "finalize_conventional_msg.tmpl"
+	ConventionalRetryTemplate       = "conventional_retry.tmpl"
 )
 
 // Initializes the prompt package by loading the templates from the embedded file system.
@@ -0,0 +1,55 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rammstein4o/git-gpt/utils"
+)
+
+// The prompts carry text written by the author verbatim, nothing may be escaped on the way to the model.
+func TestPromptsAreNotEscaped(t *testing.T) {
+	const text = `Mention <a@b.c> & "quotes" in it's body`
+
+	tests := []struct {
+		name string
+		data utils.Data
+	}{
+		{UserInstructionTemplate, utils.Data{"instruction": text}},
+		{PreviousMessageTemplate, utils.Data{"message": text}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := utils.GetTemplateByString(tt.name, tt.data)
+			if err != nil {
+				t.Fatalf("GetTemplateByString() error = %v", err)
+			}
+			if !strings.Contains(out, text) {
+				t.Errorf("rendered prompt does not contain %q:\n%s", text, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rammstein4o/git-gpt/utils"
+)
+
+// PullRequest holds the sections of a pull request description, every one of them Markdown.
+type PullRequest struct {
+	Summary string `json:"summary"`
+	Changes string `json:"changes"`
+	Testing string `json:"testing"`
+	Risks   string `json:"risks"`
+}
+
+// Render renders the description from the pull request description template.
+func (pr PullRequest) Render() (string, error) {
+	return utils.GetTemplateByString(
+		PullRequestDescriptionTemplate,
+		utils.Data{
+			"summary": pr.Summary,
+			"changes": pr.Changes,
+			"testing": pr.Testing,
+			"risks":   pr.Risks,
+		},
+	)
+}
+
+// parsePullRequest extracts the JSON object of the sections from the model answer.
+// An answer that can not be parsed is kept as the summary, so that nothing the model said gets lost.
+func parsePullRequest(answer string) PullRequest {
+	answer = strings.TrimSpace(answer)
+
+	start := strings.Index(answer, "{")
+	end := strings.LastIndex(answer, "}")
+	if start != -1 && end > start {
+		var pr PullRequest
+		if err := json.Unmarshal([]byte(answer[start:end+1]), &pr); err == nil {
+			pr.Summary = strings.TrimSpace(pr.Summary)
+			pr.Changes = strings.TrimSpace(pr.Changes)
+			pr.Testing = strings.TrimSpace(pr.Testing)
+			pr.Risks = strings.TrimSpace(pr.Risks)
+			return pr
+		}
+	}
+
+	return PullRequest{Summary: answer}
+}
+
+// DescribePullRequest writes the description of a branch from its commit messages and the summaries of its changes.
+// Summaries that do not fit into a single chunk are condensed first.
+func (c *client) DescribePullRequest(ctx context.Context, commitLog string, changes []string) (PullRequest, error) {
+	summary := strings.Join(changes, "\n")
+	if c.countTextTokens(summary) > c.maxChunkSize {
+		condensed, err := c.SummarizeChanges(ctx, changes)
+		if err != nil {
+			return PullRequest{}, err
+		}
+		summary = condensed
+	}
+
+	systemMsg, err := utils.GetTemplateByString(
+		SummarizePullRequestTemplate,
+		utils.Data{},
+	)
+	if err != nil {
+		return PullRequest{}, err
+	}
+
+	systemMsgs := []string{systemMsg}
+
+	languageMsg, err := c.languageMessage()
+	if err != nil {
+		return PullRequest{}, err
+	}
+	if languageMsg != "" {
+		systemMsgs = append(systemMsgs, languageMsg)
+	}
+
+	prompt := fmt.Sprintf("### Commits\n%s\n\n### Changes\n%s", strings.TrimSpace(commitLog), summary)
+
+	completion, err := c.complete(ctx, STAGE_PULL_REQUEST, prompt, systemMsgs...)
+	if err != nil {
+		return PullRequest{}, err
+	}
+
+	return parsePullRequest(completion), nil
+}
@@ -0,0 +1,216 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultMaxRetries is the number of times a failed request is retried.
+	DefaultMaxRetries = 3
+	// DefaultRequestTimeout bounds a single attempt, including reading a streamed answer.
+	DefaultRequestTimeout = 2 * time.Minute
+
+	minRetryWait = 1 * time.Second
+	maxRetryWait = 60 * time.Second
+)
+
+// RetryNotifyFunc is called before waiting for the next attempt of a failed request.
+type RetryNotifyFunc func(attempt int, wait time.Duration, reason string)
+
+// retryTransport retries requests failing with a network error, a timeout, 429 or 5xx.
+// It waits as long as the server asks for in Retry-After, otherwise it backs off exponentially with jitter.
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	timeout    time.Duration
+	notify     RetryNotifyFunc
+}
+
+// Ensure, that retryTransport does implement http.RoundTripper.
+var _ http.RoundTripper = &retryTransport{}
+
+func newRetryTransport(base http.RoundTripper, maxRetries int, timeout time.Duration, notify RetryNotifyFunc) *retryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &retryTransport{
+		base:       base,
+		maxRetries: maxRetries,
+		timeout:    timeout,
+		notify:     notify,
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 0; ; attempt++ {
+		attemptReq, cancel, err := t.attemptRequest(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.base.RoundTrip(attemptReq)
+
+		// Requests canceled by the caller are never retried.
+		if ctx.Err() != nil {
+			cancel()
+			if err == nil {
+				resp.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+
+		retryable, reason, wait := t.classify(resp, err, attempt)
+		canRetry := retryable && attempt < t.maxRetries && (req.Body == nil || req.GetBody != nil)
+		if !canRetry {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			// The attempt timeout has to cover reading the body as well.
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		cancel()
+
+		if t.notify != nil {
+			t.notify(attempt+1, wait, reason)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attemptRequest prepares the request for the given attempt with a fresh body and the attempt timeout.
+func (t *retryTransport) attemptRequest(req *http.Request, attempt int) (*http.Request, context.CancelFunc, error) {
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if t.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+	}
+
+	attemptReq := req.Clone(ctx)
+	if attempt > 0 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
+		attemptReq.Body = body
+	}
+
+	return attemptReq, cancel, nil
+}
+
+// classify decides whether the outcome of an attempt is worth retrying and how long to wait before.
+func (t *retryTransport) classify(resp *http.Response, err error, attempt int) (bool, string, time.Duration) {
+	if err != nil {
+		reason := err.Error()
+		if errors.Is(err, context.DeadlineExceeded) {
+			reason = "request timed out after " + t.timeout.String()
+		}
+		return true, reason, backoff(attempt)
+	}
+
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < http.StatusInternalServerError {
+		return false, "", 0
+	}
+	if resp.StatusCode == http.StatusNotImplemented {
+		return false, "", 0
+	}
+
+	wait, ok := retryAfter(resp.Header.Get("Retry-After"))
+	if !ok {
+		wait = backoff(attempt)
+	}
+
+	return true, resp.Status, wait
+}
+
+// backoff returns the exponential wait for the attempt with full jitter between half and the whole wait.
+func backoff(attempt int) time.Duration {
+	wait := minRetryWait << attempt
+	if wait <= 0 || wait > maxRetryWait {
+		wait = maxRetryWait
+	}
+
+	half := wait / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retryAfter parses the Retry-After header, given either in seconds or as an HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		wait = time.Until(date)
+	} else {
+		return 0, false
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+	if wait > maxRetryWait {
+		wait = maxRetryWait
+	}
+
+	return wait, true
+}
+
+// cancelOnClose releases the attempt timeout once the body was read.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,251 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// scriptedServer answers the n-th request with the n-th status, falling back to 200 once the script ran out.
+// Every scripted failure asks to be retried immediately so the tests do not wait for the backoff.
+func scriptedServer(t *testing.T, statuses ...int) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1)) - 1
+		body, _ := io.ReadAll(r.Body)
+		if n < len(statuses) {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(statuses[n])
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &calls
+}
+
+func TestRetryTransportStatuses(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		maxRetries int
+		wantStatus int
+		wantCalls  int32
+	}{
+		{"success", nil, 3, http.StatusOK, 1},
+		{"rate limited", []int{http.StatusTooManyRequests}, 3, http.StatusOK, 2},
+		{"server errors", []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable}, 3, http.StatusOK, 4},
+		{"retries exhausted", []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable}, 1, http.StatusServiceUnavailable, 2},
+		{"client error", []int{http.StatusBadRequest}, 3, http.StatusBadRequest, 1},
+		{"not implemented", []int{http.StatusNotImplemented}, 3, http.StatusNotImplemented, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, calls := scriptedServer(t, tt.statuses...)
+
+			var notified int
+			client := &http.Client{Transport: newRetryTransport(nil, tt.maxRetries, time.Second, func(attempt int, wait time.Duration, reason string) {
+				notified++
+				if attempt != notified {
+					t.Errorf("notify attempt = %d, want %d", attempt, notified)
+				}
+			})}
+
+			resp, err := client.Post(server.URL, "text/plain", strings.NewReader("payload"))
+			if err != nil {
+				t.Fatalf("Post() error = %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := atomic.LoadInt32(calls); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+			if notified != int(tt.wantCalls)-1 {
+				t.Errorf("notified = %d, want %d", notified, tt.wantCalls-1)
+			}
+			// The body has to be sent again with every attempt.
+			if tt.wantStatus == http.StatusOK && string(body) != "payload" {
+				t.Errorf("body = %q, want %q", body, "payload")
+			}
+		})
+	}
+}
+
+func TestRetryTransportRetryAfter(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var waits []time.Duration
+	client := &http.Client{Transport: newRetryTransport(nil, 3, time.Second, func(attempt int, wait time.Duration, reason string) {
+		waits = append(waits, wait)
+	})}
+
+	start := time.Now()
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+
+	if len(waits) != 1 || waits[0] != time.Second {
+		t.Errorf("waits = %v, want [1s]", waits)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want at least 1s", elapsed)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"7", 7 * time.Second, true},
+		{"-3", 0, true},
+		{"3600", maxRetryWait, true},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+		{"soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.value)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	got, ok := retryAfter(time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat))
+	if !ok || got <= 25*time.Second || got > 30*time.Second {
+		t.Errorf("retryAfter(date in 30s) = %v, %v", got, ok)
+	}
+}
+
+func TestRetryTransportAttemptTimeout(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	var reasons []string
+	client := &http.Client{Transport: newRetryTransport(nil, 1, 200*time.Millisecond, func(attempt int, wait time.Duration, reason string) {
+		reasons = append(reasons, reason)
+	})}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "ok" {
+		t.Errorf("body = %q, want %q", body, "ok")
+	}
+	if len(reasons) != 1 || !strings.Contains(reasons[0], "timed out after 200ms") {
+		t.Errorf("reasons = %q, want one timeout", reasons)
+	}
+}
+
+func TestRetryTransportAttemptTimeoutExhausted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newRetryTransport(nil, 0, 100*time.Millisecond, nil)}
+
+	_, err := client.Get(server.URL)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Get() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRetryTransportCanceled(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Cancel while the transport waits for the next attempt.
+	client := &http.Client{Transport: newRetryTransport(nil, 3, time.Second, func(attempt int, wait time.Duration, reason string) {
+		cancel()
+	})}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = client.Do(req)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() error = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("canceled request returned after %v", elapsed)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("calls = %d, want 1", got)
+	}
+}
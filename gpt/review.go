@@ -0,0 +1,139 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rammstein4o/git-gpt/utils"
+)
+
+const (
+	SEVERITY_CRITICAL = "critical"
+	SEVERITY_MAJOR    = "major"
+	SEVERITY_MINOR    = "minor"
+	SEVERITY_INFO     = "info"
+)
+
+var severityRank = map[string]int{
+	SEVERITY_CRITICAL: 0,
+	SEVERITY_MAJOR:    1,
+	SEVERITY_MINOR:    2,
+	SEVERITY_INFO:     3,
+}
+
+// ReviewFinding is a single issue reported by the model while reviewing a diff.
+type ReviewFinding struct {
+	Severity  string `json:"severity"`
+	Category  string `json:"category"`
+	Line      string `json:"line,omitempty"`
+	Summary   string `json:"summary"`
+	Rationale string `json:"rationale"`
+}
+
+// parseReviewFindings extracts the JSON array of findings from the model answer.
+// Answers that can not be parsed are kept as a single informational finding, so that nothing the model said gets lost.
+func parseReviewFindings(answer string) []ReviewFinding {
+	answer = strings.TrimSpace(answer)
+
+	start := strings.Index(answer, "[")
+	end := strings.LastIndex(answer, "]")
+	if start != -1 && end > start {
+		var findings []ReviewFinding
+		if err := json.Unmarshal([]byte(answer[start:end+1]), &findings); err == nil {
+			for i := range findings {
+				findings[i].Severity = strings.ToLower(strings.TrimSpace(findings[i].Severity))
+				if _, ok := severityRank[findings[i].Severity]; !ok {
+					findings[i].Severity = SEVERITY_INFO
+				}
+				findings[i].Category = strings.ToLower(strings.TrimSpace(findings[i].Category))
+				if findings[i].Category == "" {
+					findings[i].Category = "general"
+				}
+			}
+			return findings
+		}
+	}
+
+	if answer == "" {
+		return nil
+	}
+
+	return []ReviewFinding{
+		{
+			Severity:  SEVERITY_INFO,
+			Category:  "general",
+			Summary:   "Unstructured review feedback",
+			Rationale: answer,
+		},
+	}
+}
+
+// SortReviewFindings orders findings from the most to the least severe one.
+func SortReviewFindings(findings []ReviewFinding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		return severityRank[findings[i].Severity] < severityRank[findings[j].Severity]
+	})
+}
+
+func (c *client) ReviewDiff(ctx context.Context, fileName, diff string) ([]ReviewFinding, error) {
+	systemMsg, err := utils.GetTemplateByString(
+		ReviewDiffTemplate,
+		utils.Data{
+			"devType": getDeveloperTypeByExtension(fileName),
+			"file":    filepath.Base(fileName),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	systemMsgs := []string{systemMsg}
+
+	languageMsg, err := c.languageMessage()
+	if err != nil {
+		return nil, err
+	}
+	if languageMsg != "" {
+		systemMsgs = append(systemMsgs, languageMsg)
+	}
+
+	findings := make([]ReviewFinding, 0)
+
+	chunks := utils.SplitDiff(diff, c.maxChunkSize, c.countTextTokens)
+	for _, chunk := range chunks {
+		completion, err := c.complete(ctx, STAGE_REVIEW, chunk, systemMsgs...)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, parseReviewFindings(completion)...)
+	}
+
+	c.stats.addFile()
+	SortReviewFindings(findings)
+	return findings, nil
+}
@@ -22,20 +22,144 @@
 
 package gpt
 
-import "strconv"
+import (
+	"fmt"
+	"strconv"
+	"sync"
 
+	"github.com/sashabaranov/go-openai"
+)
+
+// Stages of a run, used to break down the usage and the cost.
+const (
+	STAGE_SUMMARIZE_FILE    = "summarize_file"
+	STAGE_SUMMARIZE_DIFF    = "summarize_diff"
+	STAGE_SUMMARIZE_CHANGES = "summarize_changes"
+	STAGE_FINALIZE          = "finalize"
+	STAGE_REVIEW            = "review"
+	STAGE_PULL_REQUEST      = "pull_request"
+	STAGE_CHANGELOG         = "changelog"
+)
+
+// stageOrder is the order in which the stages run.
+var stageOrder = []string{
+	STAGE_SUMMARIZE_FILE,
+	STAGE_SUMMARIZE_DIFF,
+	STAGE_SUMMARIZE_CHANGES,
+	STAGE_FINALIZE,
+	STAGE_REVIEW,
+	STAGE_PULL_REQUEST,
+	STAGE_CHANGELOG,
+}
+
+// StageStats is the usage and the estimated cost of a single stage.
+type StageStats struct {
+	Stage            string
+	NumRequests      int
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+}
+
+// Stats collects the token usage of a run. It is safe for concurrent use.
 type Stats struct {
+	mu sync.Mutex
+
 	NumRequests      int
 	PromptTokens     int
 	CompletionTokens int
 	TotalTokens      int
 	NumFiles         int
+	CacheHits        int
+	// Cost is the estimated spend in USD, it is only meaningful when CostKnown is set.
+	Cost      float64
+	CostKnown bool
+
+	stages map[string]*StageStats
+	// reserved is the worst-case cost of the requests in flight.
+	reserved float64
+}
+
+func (s *Stats) addUsage(stage string, usage openai.Usage, cost float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.NumRequests += 1
+	s.PromptTokens += usage.PromptTokens
+	s.CompletionTokens += usage.CompletionTokens
+	s.TotalTokens += usage.TotalTokens
+	s.Cost += cost
+
+	if s.stages == nil {
+		s.stages = make(map[string]*StageStats)
+	}
+	st, ok := s.stages[stage]
+	if !ok {
+		st = &StageStats{Stage: stage}
+		s.stages[stage] = st
+	}
+	st.NumRequests += 1
+	st.PromptTokens += usage.PromptTokens
+	st.CompletionTokens += usage.CompletionTokens
+	st.Cost += cost
+}
+
+func (s *Stats) addFile() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.NumFiles += 1
+}
+
+func (s *Stats) addCacheHit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.NumFiles += 1
+	s.CacheHits += 1
+}
+
+// Stages returns the usage of every stage that sent requests, in the order the stages run.
+func (s *Stats) Stages() []StageStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stages := make([]StageStats, 0, len(s.stages))
+	for _, stage := range stageOrder {
+		if st, ok := s.stages[stage]; ok {
+			stages = append(stages, *st)
+		}
+	}
+	return stages
+}
+
+// formatCost formats an estimated spend in USD.
+func formatCost(cost float64) string {
+	return fmt.Sprintf("~$%.4f", cost)
+}
+
+func (st StageStats) String() string {
+	return st.Stage + ": " +
+		"PromptTokens: " + strconv.Itoa(st.PromptTokens) +
+		", CompletionTokens: " + strconv.Itoa(st.CompletionTokens) +
+		", NumRequests: " + strconv.Itoa(st.NumRequests) +
+		", Cost: " + formatCost(st.Cost)
 }
 
 func (s *Stats) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cost := "unknown"
+	if s.CostKnown {
+		cost = formatCost(s.Cost)
+	}
+
 	return "PromptTokens: " + strconv.Itoa(s.PromptTokens) +
 		", CompletionTokens: " + strconv.Itoa(s.CompletionTokens) +
 		", TotalTokens: " + strconv.Itoa(s.TotalTokens) +
 		", NumRequests: " + strconv.Itoa(s.NumRequests) +
-		", NumFiles: " + strconv.Itoa(s.NumFiles)
+		", NumFiles: " + strconv.Itoa(s.NumFiles) +
+		", CacheHits: " + strconv.Itoa(s.CacheHits) +
+		", Cost: " + cost
 }
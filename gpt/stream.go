@@ -0,0 +1,94 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// completeStream is the streaming counterpart of complete. Tokens are rendered to the stream writer as they arrive.
+// The streamed text is only returned when the stream finished, partial output is discarded on cancellation.
+func (c *client) completeStream(ctx context.Context, stage, content string, systemMessages ...string) (string, error) {
+	req, promptTokens, err := c.newChatCompletionRequest(content, systemMessages...)
+	if err != nil {
+		return "", err
+	}
+	req.Stream = true
+
+	release, err := c.reserveBudget(stage, promptTokens, 1)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	w := c.streamWriter
+	if w == nil {
+		w = io.Discard
+	}
+
+	received := false
+	resp, err := c.backend.CreateChatCompletionStream(ctx, req, func(delta string) {
+		received = true
+		_, _ = io.WriteString(w, delta)
+	})
+
+	// Leave the terminal on a fresh line, even when the stream broke off in the middle of a line.
+	if received {
+		_, _ = io.WriteString(w, "\n")
+	}
+
+	// Nothing was paid for when the request failed before anything arrived.
+	if err != nil && !received {
+		return "", err
+	}
+
+	completion := ""
+	if len(resp.Choices) > 0 {
+		completion = resp.Choices[0].Message.Content
+	}
+
+	// Streamed answers usually come without usage, estimate it from the request and the received text.
+	if resp.Usage.TotalTokens == 0 {
+		completionTokens := c.countTextTokens(completion)
+		resp.Usage = openai.Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		}
+	}
+	c.addUsage(stage, resp.Usage)
+
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", fmt.Errorf("streaming interrupted after %d characters: %w", len(completion), ctxErr)
+		}
+		return "", err
+	}
+
+	return strings.TrimSpace(completion), nil
+}
@@ -0,0 +1,122 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+	"github.com/sashabaranov/go-openai"
+)
+
+var (
+	// encodings caches the tokenizers by model, building one is expensive.
+	// A nil entry remembers that no tokenizer could be loaded for the model.
+	encodings   = make(map[string]*tiktoken.Tiktoken)
+	encodingsMu sync.Mutex
+)
+
+// Use the BPE files embedded in the binary, tiktoken downloads them on first use otherwise,
+// which would let even a dry run reach the network.
+func init() {
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// encodingForModel returns the tokenizer of the encoding, or of the model when a model name is given.
+func encodingForModel(model string) (*tiktoken.Tiktoken, error) {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+
+	if tkm, ok := encodings[model]; ok {
+		if tkm == nil {
+			return nil, fmt.Errorf("no encoding available for model %s", model)
+		}
+		return tkm, nil
+	}
+
+	tkm, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		tkm, err = tiktoken.GetEncoding(model)
+	}
+	if err != nil {
+		encodings[model] = nil
+		return nil, err
+	}
+
+	encodings[model] = tkm
+	return tkm, nil
+}
+
+// encodingForModelInfo returns the tokenizer of the model, falling back to cl100k_base.
+func encodingForModelInfo(info ModelInfo) (*tiktoken.Tiktoken, error) {
+	tkm, err := encodingForModel(info.Encoding)
+	if err != nil {
+		tkm, err = encodingForModel(tiktoken.MODEL_CL100K_BASE)
+	}
+	return tkm, err
+}
+
+// countTokens estimates the number of prompt tokens of the chat messages.
+// When no tokenizer can be loaded, it falls back to the usual four characters per token.
+func countTokens(info ModelInfo, messages ...openai.ChatCompletionMessage) int {
+	tkm, err := encodingForModelInfo(info)
+
+	count := func(text string) int {
+		if err != nil {
+			return (len(text) + 3) / 4
+		}
+		return len(tkm.Encode(text, nil, nil))
+	}
+
+	numTokens := 0
+	for _, msg := range messages {
+		numTokens += *info.TokensPerMessage
+		numTokens += count(msg.Content)
+		numTokens += count(msg.Role)
+		numTokens += count(msg.Name)
+		if msg.Name != "" {
+			numTokens += *info.TokensPerName
+		}
+	}
+	// every reply is primed with <|start|>assistant<|message|>
+	numTokens += 3
+	return numTokens
+}
+
+// countTextTokens estimates the number of tokens of a plain text.
+// When no tokenizer can be loaded, it falls back to the usual four characters per token.
+func countTextTokens(info ModelInfo, text string) int {
+	tkm, err := encodingForModelInfo(info)
+	if err != nil {
+		return (len(text) + 3) / 4
+	}
+
+	return len(tkm.Encode(text, nil, nil))
+}
+
+// countTextTokens estimates the number of tokens of a plain text for the configured model.
+func (c *client) countTextTokens(text string) int {
+	return countTextTokens(c.modelInfo, text)
+}
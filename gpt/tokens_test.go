@@ -0,0 +1,69 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package gpt
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+type failingTransport struct {
+	t *testing.T
+}
+
+func (ft failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ft.t.Errorf("unexpected request to %s", req.URL)
+	return nil, errors.New("no network")
+}
+
+// The tokenizers are embedded, so counting tokens, e.g. in a dry run, never reaches the network.
+func TestEncodingIsOffline(t *testing.T) {
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+
+	transport := http.DefaultTransport
+	http.DefaultTransport = failingTransport{t: t}
+	t.Cleanup(func() { http.DefaultTransport = transport })
+
+	encodingsMu.Lock()
+	saved := encodings
+	encodings = make(map[string]*tiktoken.Tiktoken)
+	encodingsMu.Unlock()
+	t.Cleanup(func() {
+		encodingsMu.Lock()
+		encodings = saved
+		encodingsMu.Unlock()
+	})
+
+	for _, model := range []string{"gpt-4", tiktoken.MODEL_CL100K_BASE, "p50k_base"} {
+		tkm, err := encodingForModel(model)
+		if err != nil {
+			t.Fatalf("encodingForModel(%q) error = %v", model, err)
+		}
+		if n := len(tkm.Encode("hello world", nil, nil)); n != 2 {
+			t.Errorf("encodingForModel(%q) counts %d tokens for hello world, want 2", model, n)
+		}
+	}
+}
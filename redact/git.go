@@ -0,0 +1,117 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package redact
+
+import (
+	"github.com/rammstein4o/git-gpt/git"
+)
+
+// NotifyFunc is called for every file that had secrets redacted.
+type NotifyFunc func(name string, findings []Finding)
+
+// Ensure, that redactingGit does implement git.Git.
+var _ git.Git = &redactingGit{}
+
+// redactingGit redacts the file contents, the diffs and the commit messages of the wrapped git helper,
+// everything else passes through.
+type redactingGit struct {
+	git.Git
+	redactor *Redactor
+	notify   NotifyFunc
+}
+
+// NewGit wraps the git helper so that no file content, diff or commit message it returns contains a secret.
+func NewGit(gitHelper git.Git, redactor *Redactor, notify NotifyFunc) git.Git {
+	return &redactingGit{
+		Git:      gitHelper,
+		redactor: redactor,
+		notify:   notify,
+	}
+}
+
+// redact redacts the output of a successful call.
+func (rg *redactingGit) redact(name, text string, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+
+	redacted, findings, err := rg.redactor.Redact(name, text)
+	if err != nil {
+		return "", err
+	}
+	if len(findings) > 0 && rg.notify != nil {
+		rg.notify(name, findings)
+	}
+
+	return redacted, nil
+}
+
+// ContentFingerprint adds the redaction settings, what was summarized from unredacted or differently redacted
+// content must not be reused.
+func (rg *redactingGit) ContentFingerprint() string {
+	return rg.Git.ContentFingerprint() + "\x00redact\x00" + rg.redactor.Fingerprint()
+}
+
+func (rg *redactingGit) DiffFile(file string) (string, error) {
+	diff, err := rg.Git.DiffFile(file)
+	return rg.redact(file, diff, err)
+}
+
+func (rg *redactingGit) DiffMove(oldFile, newFile string) (string, error) {
+	diff, err := rg.Git.DiffMove(oldFile, newFile)
+	return rg.redact(newFile, diff, err)
+}
+
+func (rg *redactingGit) ShowStagedFile(file string) (string, error) {
+	content, err := rg.Git.ShowStagedFile(file)
+	return rg.redact(file, content, err)
+}
+
+func (rg *redactingGit) ShowDeletedFile(file string) (string, error) {
+	content, err := rg.Git.ShowDeletedFile(file)
+	return rg.redact(file, content, err)
+}
+
+func (rg *redactingGit) HeadMessage() (string, error) {
+	message, err := rg.Git.HeadMessage()
+	return rg.redact("HEAD", message, err)
+}
+
+// Log redacts the message of every commit, they are sent along to describe pull requests, changelogs and rewordings.
+func (rg *redactingGit) Log(revRange string) ([]git.CommitInfo, error) {
+	commits, err := rg.Git.Log(revRange)
+	if err != nil {
+		return nil, err
+	}
+
+	redacted := make([]git.CommitInfo, 0, len(commits))
+	for _, commit := range commits {
+		commit.Message, err = rg.redact("commit "+commit.Hash, commit.Message, nil)
+		if err != nil {
+			return nil, err
+		}
+		redacted = append(redacted, commit)
+	}
+
+	return redacted, nil
+}
@@ -0,0 +1,446 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+// Package redact finds secrets and personal data in the content sent to the model and replaces them with
+// placeholders, before anything leaves the machine.
+package redact
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Names of the built-in rules, they appear in the placeholders, e.g. [REDACTED:aws-access-key].
+const (
+	RULE_AWS_ACCESS_KEY = "aws-access-key"
+	RULE_AWS_SECRET_KEY = "aws-secret-key"
+	RULE_GCP_API_KEY    = "gcp-api-key"
+	RULE_AZURE_KEY      = "azure-key"
+	RULE_GITHUB_TOKEN   = "github-token"
+	RULE_SLACK_TOKEN    = "slack-token"
+	RULE_STRIPE_KEY     = "stripe-key"
+	RULE_OPENAI_KEY     = "openai-key"
+	RULE_JWT            = "jwt"
+	RULE_PRIVATE_KEY    = "private-key"
+	RULE_URL_PASSWORD   = "url-password"
+	RULE_EMAIL          = "email"
+	RULE_ASSIGNMENT     = "password"
+	RULE_HIGH_ENTROPY   = "high-entropy"
+	RULE_DENY           = "deny"
+)
+
+// DefaultEntropy is the Shannon entropy in bits per character above which a random looking string is a secret.
+const DefaultEntropy = 4.0
+
+// minEntropyLength is the length from which a string is checked for its entropy.
+const minEntropyLength = 20
+
+// rule replaces every match of its pattern, or only the submatch named "secret" when the pattern has one.
+type rule struct {
+	name    string
+	pattern *regexp.Regexp
+	// check filters out matches that only look like a secret, it is optional.
+	check func(secret string) bool
+}
+
+var builtinRules = []rule{
+	{
+		name:    RULE_PRIVATE_KEY,
+		pattern: regexp.MustCompile(`(?s)-----BEGIN [A-Z0-9 ]*PRIVATE KEY(?: BLOCK)?-----(?P<secret>.*?)-----END [A-Z0-9 ]*PRIVATE KEY(?: BLOCK)?-----`),
+	},
+	{
+		name:    RULE_AWS_ACCESS_KEY,
+		pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16}\b`),
+	},
+	{
+		name:    RULE_AWS_SECRET_KEY,
+		pattern: regexp.MustCompile(`(?i)aws.{0,20}?(?:secret|private).{0,20}?['"]?\s*[:=]\s*['"]?(?P<secret>[0-9a-zA-Z/+]{40})\b`),
+	},
+	{
+		name:    RULE_GCP_API_KEY,
+		pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`),
+	},
+	{
+		name:    RULE_AZURE_KEY,
+		pattern: regexp.MustCompile(`(?i)(?:AccountKey|SharedAccessKey)=(?P<secret>[A-Za-z0-9+/]{30,}={0,2})`),
+	},
+	{
+		name:    RULE_GITHUB_TOKEN,
+		pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`),
+	},
+	{
+		name:    RULE_SLACK_TOKEN,
+		pattern: regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,}\b`),
+	},
+	{
+		name:    RULE_STRIPE_KEY,
+		pattern: regexp.MustCompile(`\b[rs]k_(?:live|test)_[0-9a-zA-Z]{20,}\b`),
+	},
+	{
+		name:    RULE_OPENAI_KEY,
+		pattern: regexp.MustCompile(`\bsk-(?:proj-)?[A-Za-z0-9_\-]{32,}\b`),
+	},
+	{
+		name:    RULE_JWT,
+		pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`),
+	},
+	{
+		name:    RULE_URL_PASSWORD,
+		pattern: regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^\s:/@]+:(?P<secret>[^\s:/@]+)@`),
+	},
+	{
+		name:    RULE_EMAIL,
+		pattern: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`),
+		check:   isPersonalEmail,
+	},
+	{
+		name: RULE_ASSIGNMENT,
+		pattern: regexp.MustCompile(
+			`(?i)\b[a-z0-9_.-]*(?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key|private[_-]?key|client[_-]?secret)` +
+				`['"]?\s*(?::=|=>|[:=])\s*(?P<secret>"[^"\n]*"|'[^'\n]*'|[^\s,;'"]+)`,
+		),
+		check: isLiteralValue,
+	},
+}
+
+// highEntropyRe finds the candidates for the entropy check, runs of characters that make up keys and tokens,
+// optionally padded like base64.
+var highEntropyRe = regexp.MustCompile(`[A-Za-z0-9+/_\-]{20,}={0,2}`)
+
+// Finding is a secret that was found, the secret itself is never kept.
+type Finding struct {
+	Rule string
+	// Line is the 1-based line of the text the secret starts on.
+	Line int
+}
+
+// SecretsFoundError is returned in strict mode instead of redacting.
+type SecretsFoundError struct {
+	Name     string
+	Findings []Finding
+}
+
+func (e *SecretsFoundError) Error() string {
+	details := make([]string, 0, len(e.Findings))
+	for _, f := range e.Findings {
+		details = append(details, fmt.Sprintf("%s at line %d", f.Rule, f.Line))
+	}
+	return fmt.Sprintf(
+		"%s contains %d possible secret(s): %s; remove them or allow them with redact.allow",
+		e.Name,
+		len(e.Findings),
+		strings.Join(details, ", "),
+	)
+}
+
+type config struct {
+	allow   []string
+	deny    []string
+	entropy float64
+	strict  bool
+}
+
+type Option func(*config)
+
+// WithAllow never redacts secrets matching one of the regular expressions, e.g. the example keys of the documentation.
+func WithAllow(patterns []string) Option {
+	return func(c *config) {
+		c.allow = patterns
+	}
+}
+
+// WithDeny redacts every match of the regular expressions in addition to the built-in rules.
+func WithDeny(patterns []string) Option {
+	return func(c *config) {
+		c.deny = patterns
+	}
+}
+
+// WithEntropy sets the entropy above which random looking strings are redacted, zero disables the check.
+func WithEntropy(entropy float64) Option {
+	return func(c *config) {
+		c.entropy = entropy
+	}
+}
+
+// WithStrict makes Redact fail with a SecretsFoundError instead of redacting.
+func WithStrict(strict bool) Option {
+	return func(c *config) {
+		c.strict = strict
+	}
+}
+
+// Redactor replaces secrets with placeholders. It is safe for concurrent use.
+type Redactor struct {
+	rules   []rule
+	allow   []*regexp.Regexp
+	entropy float64
+	strict  bool
+}
+
+// New creates a redactor with the built-in rules and the configured patterns.
+func New(opts ...Option) (*Redactor, error) {
+	cfg := &config{entropy: DefaultEntropy}
+	for _, fn := range opts {
+		fn(cfg)
+	}
+
+	r := &Redactor{
+		rules:   append([]rule{}, builtinRules...),
+		entropy: cfg.entropy,
+		strict:  cfg.strict,
+	}
+
+	for _, pattern := range cfg.allow {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow pattern %q: %w", pattern, err)
+		}
+		r.allow = append(r.allow, re)
+	}
+
+	for _, pattern := range cfg.deny {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deny pattern %q: %w", pattern, err)
+		}
+		r.rules = append(r.rules, rule{name: RULE_DENY, pattern: re})
+	}
+
+	return r, nil
+}
+
+// span is a part of the text to replace.
+type span struct {
+	start, end int
+	rule       string
+}
+
+// Redact replaces the secrets in the text, name tells where the text comes from, e.g. a file name.
+// In strict mode the text is returned unchanged together with a SecretsFoundError.
+func (r *Redactor) Redact(name, text string) (string, []Finding, error) {
+	spans := make([]span, 0)
+
+	for _, rl := range r.rules {
+		secretIdx := rl.pattern.SubexpIndex("secret")
+		for _, m := range rl.pattern.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[0], m[1]
+			if secretIdx > 0 && m[2*secretIdx] >= 0 {
+				start, end = m[2*secretIdx], m[2*secretIdx+1]
+			}
+			if start == end {
+				continue
+			}
+
+			secret := text[start:end]
+			if rl.check != nil && !rl.check(secret) {
+				continue
+			}
+			if r.allowed(secret) || r.allowed(text[m[0]:m[1]]) {
+				continue
+			}
+			spans = append(spans, span{start: start, end: end, rule: rl.name})
+		}
+	}
+
+	if r.entropy > 0 {
+		for _, m := range highEntropyRe.FindAllStringIndex(text, -1) {
+			// Leave the markers of added and removed diff lines alone.
+			if (text[m[0]] == '+' || text[m[0]] == '-') && (m[0] == 0 || text[m[0]-1] == '\n') {
+				m[0]++
+			}
+
+			candidate := text[m[0]:m[1]]
+			if !looksRandom(candidate, r.entropy) || r.allowed(candidate) {
+				continue
+			}
+			spans = append(spans, span{start: m[0], end: m[1], rule: RULE_HIGH_ENTROPY})
+		}
+	}
+
+	if len(spans) == 0 {
+		return text, nil, nil
+	}
+
+	// Overlapping matches are merged into the first one, e.g. a JWT assigned to a token variable.
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		return spans[i].end > spans[j].end
+	})
+
+	merged := make([]span, 0, len(spans))
+	for _, s := range spans {
+		if n := len(merged); n > 0 && s.start < merged[n-1].end {
+			if s.end > merged[n-1].end {
+				merged[n-1].end = s.end
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+
+	findings := make([]Finding, 0, len(merged))
+	var sb strings.Builder
+	last := 0
+	for _, s := range merged {
+		findings = append(findings, Finding{
+			Rule: s.rule,
+			Line: strings.Count(text[:s.start], "\n") + 1,
+		})
+
+		sb.WriteString(text[last:s.start])
+		sb.WriteString(placeholder(s.rule, text[s.start:s.end]))
+		last = s.end
+	}
+	sb.WriteString(text[last:])
+
+	if r.strict {
+		return text, findings, &SecretsFoundError{Name: name, Findings: findings}
+	}
+
+	return sb.String(), findings, nil
+}
+
+// Fingerprint describes the settings of the redactor, two redactors with the same fingerprint redact alike.
+func (r *Redactor) Fingerprint() string {
+	parts := make([]string, 0, len(r.rules)+len(r.allow)+2)
+	for _, rl := range r.rules {
+		parts = append(parts, rl.name+"="+rl.pattern.String())
+	}
+	for _, re := range r.allow {
+		parts = append(parts, "allow="+re.String())
+	}
+	parts = append(parts, fmt.Sprintf("entropy=%g", r.entropy), fmt.Sprintf("strict=%t", r.strict))
+
+	return strings.Join(parts, "\x00")
+}
+
+// allowed tells whether the match is covered by an allow pattern.
+func (r *Redactor) allowed(match string) bool {
+	for _, re := range r.allow {
+		if re.MatchString(match) {
+			return true
+		}
+	}
+	return false
+}
+
+// placeholder replaces the secret. Quotes are kept and the line breaks of a multi-line secret are preserved,
+// so code and diffs keep their shape.
+func placeholder(ruleName, secret string) string {
+	p := "[REDACTED:" + ruleName + "]"
+
+	if len(secret) >= 2 && (secret[0] == '"' || secret[0] == '\'') && secret[len(secret)-1] == secret[0] {
+		p = string(secret[0]) + p + string(secret[0])
+	}
+
+	return p + strings.Repeat("\n", strings.Count(secret, "\n"))
+}
+
+// isLiteralValue tells whether an assigned value is a literal rather than a reference to a variable,
+// an environment variable, a function call or an empty string.
+func isLiteralValue(value string) bool {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+		inner := value[1 : len(value)-1]
+		return len(inner) >= 4 && !strings.HasPrefix(inner, "${") && !strings.Contains(inner, "REDACTED")
+	}
+
+	switch strings.ToLower(value) {
+	case "true", "false", "null", "nil", "none", "undefined":
+		return false
+	}
+
+	if len(value) < 4 || strings.ContainsAny(value, "(){}[]$<>") {
+		return false
+	}
+
+	// Identifiers like cfg.Password or user_token are references to variables.
+	isIdentifier := true
+	for _, ch := range value {
+		if !unicode.IsLetter(ch) && ch != '_' && ch != '.' {
+			isIdentifier = false
+			break
+		}
+	}
+	return !isIdentifier || !strings.ContainsAny(value, "._")
+}
+
+// isPersonalEmail skips the addresses that are not personal data, e.g. example.com or no-reply addresses.
+func isPersonalEmail(email string) bool {
+	lower := strings.ToLower(email)
+	local, domain, _ := strings.Cut(lower, "@")
+
+	for _, d := range []string{"example.com", "example.org", "example.net", "localhost", "users.noreply.github.com"} {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return false
+		}
+	}
+	return !strings.Contains(local, "noreply") && !strings.Contains(local, "no-reply")
+}
+
+// looksRandom tells whether the string mixes upper case letters, lower case letters and digits
+// with an entropy of at least the threshold, as generated keys do and words and identifiers do not.
+func looksRandom(s string, threshold float64) bool {
+	if len(s) < minEntropyLength {
+		return false
+	}
+
+	var upper, lower, digits int
+	for _, ch := range s {
+		switch {
+		case unicode.IsUpper(ch):
+			upper++
+		case unicode.IsLower(ch):
+			lower++
+		case unicode.IsDigit(ch):
+			digits++
+		}
+	}
+	if upper == 0 || lower == 0 || digits < 2 {
+		return false
+	}
+
+	return shannonEntropy(s) >= threshold
+}
+
+// shannonEntropy returns the entropy of the string in bits per character.
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+	for _, ch := range s {
+		counts[ch]++
+		total++
+	}
+
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
@@ -0,0 +1,234 @@
+// ---
+// Copyright © 2023 Radoslav Salov <rado.salov@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// ---
+
+package utils
+
+import (
+	"strings"
+)
+
+// TokenCounter returns the number of model tokens of the given text.
+type TokenCounter func(text string) int
+
+// diffSection is a part of a unified diff: the header of a file or a single hunk.
+type diffSection struct {
+	header []string
+	body   []string
+}
+
+// chunker packs whole lines into chunks of at most maxTokens tokens.
+type chunker struct {
+	count     TokenCounter
+	maxTokens int
+	chunks    []string
+	lines     []string
+	tokens    int
+}
+
+func (ch *chunker) cost(lines []string) int {
+	total := 0
+	for _, line := range lines {
+		total += ch.count(line + "\n")
+	}
+	return total
+}
+
+func (ch *chunker) fits(tokens int) bool {
+	return ch.tokens+tokens <= ch.maxTokens
+}
+
+func (ch *chunker) add(lines []string, tokens int) {
+	ch.lines = append(ch.lines, lines...)
+	ch.tokens += tokens
+}
+
+func (ch *chunker) flush() {
+	if len(ch.lines) > 0 {
+		ch.chunks = append(ch.chunks, strings.Join(ch.lines, "\n"))
+	}
+	ch.lines = nil
+	ch.tokens = 0
+}
+
+// addLines adds lines one by one, starting a new chunk with the given header whenever the current one is full.
+// Lines longer than the whole budget are split into pieces.
+func (ch *chunker) addLines(header []string, lines []string) {
+	headerTokens := ch.cost(header)
+	budget := ch.maxTokens - headerTokens
+	if budget < 1 {
+		// The header alone exceeds the budget, there is no room to repeat it.
+		header, headerTokens, budget = nil, 0, ch.maxTokens
+	}
+
+	for _, line := range lines {
+		pieces := []string{line}
+		if ch.count(line+"\n") > budget {
+			pieces = splitLine(line, budget, ch.count)
+		}
+
+		for _, piece := range pieces {
+			tokens := ch.count(piece + "\n")
+			if len(ch.lines) > 0 && !ch.fits(tokens) {
+				ch.flush()
+			}
+			if len(ch.lines) == 0 {
+				ch.add(header, headerTokens)
+			}
+			ch.add([]string{piece}, tokens)
+		}
+	}
+}
+
+// splitLine splits a single line into pieces of at most maxTokens tokens, cutting between runes.
+func splitLine(line string, maxTokens int, count TokenCounter) []string {
+	var pieces []string
+
+	runes := []rune(line)
+	for len(runes) > 0 {
+		size := len(runes)
+		if tokens := count(string(runes)); tokens > maxTokens {
+			size = len(runes) * maxTokens / tokens
+		}
+		for size > 1 && count(string(runes[:size])) > maxTokens {
+			size = size * 9 / 10
+		}
+		if size < 1 {
+			size = 1
+		}
+
+		pieces = append(pieces, string(runes[:size]))
+		runes = runes[size:]
+	}
+
+	return pieces
+}
+
+// SplitLines splits plain text into chunks of at most maxTokens tokens without breaking lines.
+// Only lines that do not fit into a chunk on their own are cut.
+func SplitLines(text string, maxTokens int, count TokenCounter) []string {
+	if maxTokens <= 0 || count(text) <= maxTokens {
+		return []string{text}
+	}
+
+	ch := &chunker{count: count, maxTokens: maxTokens}
+	ch.addLines(nil, strings.Split(text, "\n"))
+	ch.flush()
+
+	return ch.chunks
+}
+
+// parseDiffSections splits a unified diff into file headers and hunks.
+func parseDiffSections(diff string) []diffSection {
+	var sections []diffSection
+
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			sections = append(sections, diffSection{header: []string{line}})
+		case strings.HasPrefix(line, "@@"):
+			sections = append(sections, diffSection{header: []string{line}})
+		case len(sections) == 0:
+			sections = append(sections, diffSection{header: []string{line}})
+		case len(sections[len(sections)-1].body) == 0 && !strings.HasPrefix(sections[len(sections)-1].header[0], "@@"):
+			// Still in the file header: index, mode and ---/+++ lines.
+			last := &sections[len(sections)-1]
+			last.header = append(last.header, line)
+		default:
+			last := &sections[len(sections)-1]
+			last.body = append(last.body, line)
+		}
+	}
+
+	return sections
+}
+
+// SplitDiff splits a unified diff into chunks of at most maxTokens tokens.
+// Chunks are cut at file and hunk boundaries where possible and lines are kept intact.
+// A hunk that does not fit into a single chunk is split on line boundaries
+// and every continuation chunk repeats the file and hunk headers.
+func SplitDiff(diff string, maxTokens int, count TokenCounter) []string {
+	if maxTokens <= 0 || count(diff) <= maxTokens {
+		return []string{diff}
+	}
+
+	ch := &chunker{count: count, maxTokens: maxTokens}
+
+	var fileHeader []string
+	// fileHeaderAdded tells whether the current chunk already starts the current file.
+	fileHeaderAdded := false
+	pending := false
+
+	addUnit := func(lines []string) {
+		tokens := ch.cost(lines)
+		if !ch.fits(tokens) {
+			ch.flush()
+			fileHeaderAdded = false
+		}
+		ch.add(lines, tokens)
+	}
+
+	for _, section := range parseDiffSections(diff) {
+		if !strings.HasPrefix(section.header[0], "@@") {
+			// A file without hunks, e.g. a mode change or a binary file.
+			if pending {
+				addUnit(fileHeader)
+			}
+			fileHeader = append(section.header, section.body...)
+			fileHeaderAdded = false
+			pending = true
+			continue
+		}
+		pending = false
+
+		hunk := append(append([]string{}, section.header...), section.body...)
+
+		unit := hunk
+		if !fileHeaderAdded {
+			unit = append(append([]string{}, fileHeader...), hunk...)
+		}
+		if tokens := ch.cost(unit); ch.fits(tokens) {
+			ch.add(unit, tokens)
+			fileHeaderAdded = true
+			continue
+		}
+
+		// Start a new chunk, which has to repeat the file header.
+		full := append(append([]string{}, fileHeader...), hunk...)
+		if tokens := ch.cost(full); tokens <= maxTokens {
+			ch.flush()
+			ch.add(full, tokens)
+			fileHeaderAdded = true
+			continue
+		}
+
+		// The hunk is too large for a chunk of its own, split its lines and repeat the headers.
+		ch.flush()
+		ch.addLines(append(append([]string{}, fileHeader...), section.header...), section.body)
+		fileHeaderAdded = true
+	}
+	if pending {
+		addUnit(fileHeader)
+	}
+	ch.flush()
+
+	return ch.chunks
+}
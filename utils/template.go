@@ -24,21 +24,49 @@ package utils
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"embed"
+	"errors"
 	"fmt"
-	"html/template"
 	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"text/template"
+	"text/template/parse"
 )
 
+// TEMPLATE_SOURCE_EMBEDDED is the source of the templates built into the binary.
+const TEMPLATE_SOURCE_EMBEDDED = "embedded"
+
+// templateExt is the extension of the template files.
+const templateExt = ".tmpl"
+
 // Data defines a custom type for the template data.
 type Data map[string]interface{}
 
 var (
-	templates    map[string]*template.Template
-	templatesDir = "templates"
+	templates map[string]*template.Template
+	// templateVersions holds a hash of the source of every loaded template.
+	templateVersions map[string]string
+	// templateSources tells where every template was loaded from, TEMPLATE_SOURCE_EMBEDDED or a file path.
+	templateSources map[string]string
+	// embeddedSources keeps the built-in templates, so they can be exported.
+	embeddedSources map[string][]byte
+	// templateErrors holds the overrides that could not be parsed, the previous template stays in use.
+	templateErrors map[string]error
+	templatesDir   = "templates"
 )
 
+// TemplateInfo describes a loaded template.
+// Err is set when an override of the template could not be parsed.
+type TemplateInfo struct {
+	Name   string
+	Source string
+	Err    error
+}
+
 func NewTemplateByString(format string, data map[string]interface{}) (string, error) {
 	t, err := template.New("message").Parse(format)
 	if err != nil {
@@ -73,36 +101,236 @@ func processTemplate(name string, data map[string]interface{}) (*bytes.Buffer, e
 // GetTemplateByString returns the parsed template as a string.
 func GetTemplateByString(name string, data map[string]interface{}) (string, error) {
 	tpl, err := processTemplate(name, data)
-	return strings.TrimSpace(tpl.String()), err
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(tpl.String()), nil
 }
 
 // GetTemplateByBytes returns the parsed template as a byte.
 func GetTemplateByBytes(name string, data map[string]interface{}) ([]byte, error) {
 	tpl, err := processTemplate(name, data)
-	return bytes.TrimSpace(tpl.Bytes()), err
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(tpl.Bytes()), nil
 }
 
-// LoadTemplates loads all the templates found in the templates directory.
-func LoadTemplates(files embed.FS) error {
+// addTemplate parses the template source and registers it under the given name.
+func addTemplate(name string, source []byte, origin string) error {
+	pt, err := template.New(name).Parse(string(source))
+	if err != nil {
+		return err
+	}
+
 	if templates == nil {
 		templates = make(map[string]*template.Template)
+		templateVersions = make(map[string]string)
+		templateSources = make(map[string]string)
+		embeddedSources = make(map[string][]byte)
+		templateErrors = make(map[string]error)
 	}
+
+	templates[name] = pt
+	templateVersions[name] = fmt.Sprintf("%x", sha256.Sum256(source))
+	templateSources[name] = origin
+	return nil
+}
+
+// LoadTemplates loads all the templates found in the templates directory.
+func LoadTemplates(files embed.FS) error {
 	tmplFiles, err := fs.ReadDir(files, templatesDir)
 	if err != nil {
 		return err
 	}
 
 	for _, tmpl := range tmplFiles {
-		if tmpl.IsDir() {
+		if tmpl.IsDir() || filepath.Ext(tmpl.Name()) != templateExt {
 			continue
 		}
 
-		pt, err := template.ParseFS(files, templatesDir+"/"+tmpl.Name())
+		source, err := fs.ReadFile(files, templatesDir+"/"+tmpl.Name())
 		if err != nil {
 			return err
 		}
 
-		templates[tmpl.Name()] = pt
+		if err := addTemplate(tmpl.Name(), source, TEMPLATE_SOURCE_EMBEDDED); err != nil {
+			return err
+		}
+		embeddedSources[tmpl.Name()] = source
 	}
 	return nil
 }
+
+// LoadTemplateOverrides replaces the built-in templates with the files of the same name found in the directories.
+// The directories are given from the lowest to the highest priority, missing directories are skipped.
+// Files that do not match a built-in template are ignored. A file that cannot be parsed is reported
+// and the template it was meant to override stays in use.
+func LoadTemplateOverrides(dirs ...string) error {
+	var errs []error
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || filepath.Ext(name) != templateExt {
+				continue
+			}
+			if _, ok := embeddedSources[name]; !ok {
+				continue
+			}
+
+			file := filepath.Join(dir, name)
+			source, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+
+			if err := addTemplate(name, source, file); err != nil {
+				err = fmt.Errorf("template %s: %w", file, err)
+				templateErrors[name] = err
+				errs = append(errs, err)
+				continue
+			}
+			delete(templateErrors, name)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ListTemplates returns the loaded templates sorted by name, together with where each one was loaded from.
+func ListTemplates() []TemplateInfo {
+	infos := make([]TemplateInfo, 0, len(templates))
+	for name := range templates {
+		infos = append(infos, TemplateInfo{
+			Name:   name,
+			Source: templateSources[name],
+			Err:    templateErrors[name],
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// ExportTemplates writes the built-in templates into the directory and returns the written files.
+// Existing files are only replaced when overwrite is set.
+func ExportTemplates(dir string, overwrite bool) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(embeddedSources))
+	for name := range embeddedSources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	written := make([]string, 0, len(names))
+	for _, name := range names {
+		file := filepath.Join(dir, name)
+		if !overwrite && IsFile(file) {
+			continue
+		}
+
+		if err := os.WriteFile(file, embeddedSources[name], 0o644); err != nil {
+			return written, err
+		}
+		written = append(written, file)
+	}
+
+	return written, nil
+}
+
+// CheckTemplate renders the template with sample data, once with every field set and once with every field empty,
+// so both sides of the conditions are executed.
+func CheckTemplate(name string) error {
+	t, ok := templates[name]
+	if !ok {
+		return fmt.Errorf("template %s not found", name)
+	}
+
+	fields := make(map[string]bool)
+	if t.Tree != nil {
+		collectTemplateFields(t.Tree.Root, fields)
+	}
+
+	sample := make(Data)
+	empty := make(Data)
+	for field := range fields {
+		sample[field] = "sample " + field
+		empty[field] = ""
+	}
+
+	for _, data := range []Data{sample, empty} {
+		out, err := processTemplate(name, data)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(out.String()) == "" {
+			return fmt.Errorf("template %s renders to an empty text", name)
+		}
+	}
+	return nil
+}
+
+// collectTemplateFields gathers the names of the top-level fields used in the template, e.g. file for {{ .file }}.
+func collectTemplateFields(node parse.Node, fields map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectTemplateFields(child, fields)
+		}
+	case *parse.ActionNode:
+		collectTemplateFields(n.Pipe, fields)
+	case *parse.IfNode:
+		collectTemplateFields(n.Pipe, fields)
+		collectTemplateFields(n.List, fields)
+		collectTemplateFields(n.ElseList, fields)
+	case *parse.RangeNode:
+		collectTemplateFields(n.Pipe, fields)
+		collectTemplateFields(n.List, fields)
+		collectTemplateFields(n.ElseList, fields)
+	case *parse.WithNode:
+		collectTemplateFields(n.Pipe, fields)
+		collectTemplateFields(n.List, fields)
+		collectTemplateFields(n.ElseList, fields)
+	case *parse.TemplateNode:
+		collectTemplateFields(n.Pipe, fields)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				collectTemplateFields(arg, fields)
+			}
+		}
+	case *parse.FieldNode:
+		fields[n.Ident[0]] = true
+	}
+}
+
+// TemplateVersion returns a hash identifying the current source of the given templates.
+// It changes whenever one of the templates changes, so it can be used to invalidate cached answers.
+func TemplateVersion(names ...string) string {
+	h := sha256.New()
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write([]byte(templateVersions[name]))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
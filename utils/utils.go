@@ -29,7 +29,6 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"unicode/utf8"
 )
 
 var (
@@ -176,17 +175,41 @@ func findGitDir(dir string) string {
 	return ""
 }
 
-func CwdToGitRoot() error {
+// GitRoot returns the closest directory containing .git, starting from the current working directory.
+func GitRoot() (string, error) {
 	// Get the current working directory
 	currentDir, err := os.Getwd()
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// Find the closest parent directory with a .git folder
 	gitDir := findGitDir(currentDir)
 	if gitDir == "" {
-		return fmt.Errorf("no .git directory found in any parent directory")
+		return "", fmt.Errorf("no .git directory found in any parent directory")
+	}
+
+	return gitDir, nil
+}
+
+// ConfigDir returns the directory of the user configuration of git-gpt, $XDG_CONFIG_HOME/git-gpt or ~/.config/git-gpt.
+func ConfigDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "git-gpt"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".config", "git-gpt"), nil
+}
+
+func CwdToGitRoot() error {
+	gitDir, err := GitRoot()
+	if err != nil {
+		return err
 	}
 
 	// Change the current working directory to the one containing .git
@@ -207,35 +230,3 @@ func IsBinaryFile(fileName string) bool {
 	}
 	return false
 }
-
-func SplitText(text string, chunkSize int) []string {
-	var chunks []string
-
-	// Split the text into words
-	words := strings.Fields(text)
-
-	// Initialize variables to track current chunk and remaining space
-	currentChunk := ""
-	remainingSpace := chunkSize
-
-	// Iterate through words and add them to the current chunk until it reaches the chunkSize
-	for _, word := range words {
-		wordLength := utf8.RuneCountInString(word) + 1 // Add 1 for space
-
-		// If adding the current word doesn't exceed the remaining space, add it to the chunk
-		if wordLength <= remainingSpace {
-			currentChunk += word + " "
-			remainingSpace -= wordLength
-		} else {
-			// If adding the word exceeds the remaining space, start a new chunk
-			chunks = append(chunks, strings.TrimSpace(currentChunk))
-			currentChunk = word + " "
-			remainingSpace = chunkSize - wordLength
-		}
-	}
-
-	// Add the last chunk
-	chunks = append(chunks, strings.TrimSpace(currentChunk))
-
-	return chunks
-}